@@ -0,0 +1,145 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the aggregation of files along the record dimension.
+
+package cdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var (
+	errNoFiles        = errors.New("no files to aggregate")
+	errReadOnly       = errors.New("file is read-only")
+	errHeaderMismatch = errors.New("header does not match")
+)
+
+// Aggregate presents files with compatible headers as a single read-only File whose records are
+// the records of all files in order, like the joinExisting aggregation of NcML.
+// The headers are compatible if they have the same dimensions and the same variables, with the same
+// dimensions and types, in the same order; attributes may differ.  The Header of the aggregate and
+// the data of the non-record variables are those of the first file.  The number of records of
+// every file must be known, see File.NumRecs.
+//
+// The aggregate's Readers, StridedReaders and the like read the records from the underlying storage
+// of the file they are in, so begin and end may span several files.  Writers return errors.
+func Aggregate(files ...*File) (*File, error) {
+	if len(files) == 0 {
+		return nil, errNoFiles
+	}
+	h := files[0].Header
+	offs, size := h.slabs()
+	a := &aggregate{offs: offs, size: size}
+	for i, f := range files {
+		if err := h.compatible(f.Header); err != nil {
+			return nil, fmt.Errorf("file %d: %v", i, err)
+		}
+		nr, err := f.recordCount()
+		if err != nil {
+			return nil, fmt.Errorf("file %d: %v", i, err)
+		}
+		o, _ := f.Header.slabs()
+		a.parts = append(a.parts, aggregatePart{rw: f.rw, offs: o, first: a.numrecs, n: nr})
+		a.numrecs += nr
+	}
+	return &File{rw: a, Header: h, numrecs: a.numrecs}, nil
+}
+
+// compatible returns errHeaderMismatch, with the offending name, if the data of g can not be read as that of h.
+func (h *Header) compatible(g *Header) error {
+	if len(g.dim) != len(h.dim) || len(g.vars) != len(h.vars) {
+		return errHeaderMismatch
+	}
+	for i := range h.dim {
+		if g.dim[i] != h.dim[i] {
+			return fmt.Errorf("%v: dimension %s", errHeaderMismatch, h.dim[i].name)
+		}
+	}
+	hoffs, _ := h.slabs()
+	goffs, _ := g.slabs()
+	for i := range h.vars {
+		hv, gv := &h.vars[i], &g.vars[i]
+		if gv.name != hv.name || gv.dtype != hv.dtype || len(gv.dim) != len(hv.dim) ||
+			hv.isRecordVariable() && gv.begin-goffs != hv.begin-hoffs {
+			return fmt.Errorf("%v: variable %s", errHeaderMismatch, hv.name)
+		}
+		for j := range hv.dim {
+			if gv.dim[j] != hv.dim[j] {
+				return fmt.Errorf("%v: variable %s", errHeaderMismatch, hv.name)
+			}
+		}
+	}
+	return nil
+}
+
+// An aggregate is the ReaderWriterAt of an aggregated File.  Offsets before the
+// record section refer to the first file, those of records first..first+n-1 to the
+// record section of the part that holds them.
+type aggregate struct {
+	offs, size int64 // the record section in the header of the aggregate
+	numrecs    int64
+	parts      []aggregatePart
+}
+
+type aggregatePart struct {
+	rw       ReaderWriterAt
+	offs     int64 // start of the record section of this part
+	first, n int64 // records of the aggregate in this part
+}
+
+func (a *aggregate) ReadAt(p []byte, off int64) (n int, err error) {
+	for len(p) > 0 {
+		rw, pos, l := a.locate(off)
+		if rw == nil {
+			return n, io.EOF
+		}
+		if l > int64(len(p)) {
+			l = int64(len(p))
+		}
+		m, err := rw.ReadAt(p[:l], pos)
+		n += m
+		if m < int(l) {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		p, off = p[l:], off+l
+	}
+	return n, nil
+}
+
+func (a *aggregate) WriteAt(p []byte, off int64) (n int, err error) { return 0, errReadOnly }
+
+// locate returns the storage and position of the byte at offset off of the aggregate, and the number of
+// bytes that follow it contiguously, or a nil rw if it is beyond the last record.
+func (a *aggregate) locate(off int64) (rw ReaderWriterAt, pos, l int64) {
+	if a.size == 0 {
+		return a.parts[0].rw, off, 1 << 62
+	}
+	if off < a.offs {
+		return a.parts[0].rw, off, a.offs - off
+	}
+	r, within := (off-a.offs)/a.size, (off-a.offs)%a.size
+	i := sort.Search(len(a.parts), func(i int) bool { return a.parts[i].first+a.parts[i].n > r })
+	if i == len(a.parts) {
+		return nil, 0, 0
+	}
+	pt := &a.parts[i]
+	return pt.rw, pt.offs + (r-pt.first)*a.size + within, a.size - within
+}
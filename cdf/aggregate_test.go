@@ -0,0 +1,100 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	var files []*File
+	nrecs := []int{2, 0, 3, 1}
+	rec := 0
+	for i, nr := range nrecs {
+		h := NewHeader([]string{"time", "x"}, []int{0, 2})
+		h.AddVariable("x", []string{"x"}, []float32{})
+		h.AddVariable("a", []string{"time", "x"}, []int16{})
+		h.AddVariable("time", []string{"time"}, []float64{})
+		if i == 2 {
+			h.AddAttribute("", "history", "a longer header")
+		}
+		h.Define()
+
+		f, cleanup := createTestFile(t, h)
+		defer cleanup()
+		if n, _ := mustWriter(t, f, "x", nil, nil).Write([]float32{float32(i), 1}); n != 2 {
+			t.Fatal("writing x")
+		}
+		a, err := f.Appender()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for r := 0; r < nr; r++ {
+			if _, err := a.Append(map[string]interface{}{"a": []int16{int16(rec), -int16(rec)}, "time": []float64{float64(rec)}}); err != nil {
+				t.Fatal(err)
+			}
+			rec++
+		}
+		files = append(files, f)
+	}
+
+	f, err := Aggregate(files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.NumRecs() != int64(rec) {
+		t.Error("NumRecs:", f.NumRecs())
+	}
+
+	x, err := ReadVar[float32](f, "x", nil, nil)
+	if err != nil || len(x) != 2 || x[0] != 0 {
+		t.Error("reading x:", x, err)
+	}
+	tm, err := ReadVar[float64](f, "time", nil, nil)
+	if err != nil || len(tm) != rec {
+		t.Fatal("reading time:", tm, err)
+	}
+	for i, v := range tm {
+		if v != float64(i) {
+			t.Errorf("time[%d] = %v", i, v)
+		}
+	}
+
+	// across file boundaries
+	a := make([]int16, 8)
+	if n, _ := mustReader(t, f, "a", []int{1, 1}, []int{5, 0}).Read(a); n != 8 || a[0] != -1 || a[1] != 2 || a[7] != 5 {
+		t.Error("reading a:", a[:n])
+	}
+	r, err := f.StridedReader("a", []int{0, 0}, nil, []int{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.Read(a); n != 6 || a[0] != 0 || a[2] != 2 || a[5] != -4 {
+		t.Error("reading a strided:", a[:n])
+	}
+
+	if _, err := mustWriter(t, f, "x", nil, nil).Write([]float32{1, 2}); err != errReadOnly {
+		t.Error("expected errReadOnly, got", err)
+	}
+
+	h := NewHeader([]string{"time", "x"}, []int{0, 3})
+	h.AddVariable("a", []string{"time", "x"}, []int16{})
+	h.Define()
+	g, cleanup := createTestFile(t, h)
+	defer cleanup()
+	if _, err := Aggregate(files[0], g); err == nil {
+		t.Error("expected error for incompatible header")
+	}
+}
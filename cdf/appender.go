@@ -0,0 +1,134 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the Appender, which adds records to a file.
+
+package cdf
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	errNotRecordVariable = errors.New("not a record variable")
+	errRecordSize        = errors.New("number of values does not match the record size")
+)
+
+// An Appender appends complete records to a file and keeps the numrecs field of its header up to date,
+// so that the file is valid for other readers after every record.  An Appender may be used by
+// multiple goroutines simultaneously; their records are appended one at a time.
+// There should be only one Appender per file.
+type Appender struct {
+	f  *File
+	mu sync.Mutex
+	nr int64
+}
+
+// Appender creates an Appender for f, which appends after the last of f.NumRecs records.
+// Appender returns an error if the number of records can not be determined.
+func (f *File) Appender() (*Appender, error) {
+	nr, err := f.recordCount()
+	if err != nil {
+		return nil, err
+	}
+	return &Appender{f: f, nr: nr}, nil
+}
+
+// NumRecs returns the number of records in the file, including those appended.
+func (a *Appender) NumRecs() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.nr
+}
+
+// Append writes one record.  values maps the names of record variables to slices with the values
+// for one record, which must be of the type Writer accepts for the variable and have the length
+// of the product of the variable's non-record dimensions.  Record variables that do not appear
+// in values are filled with their fill values.  After the record has been written, the numrecs
+// field is updated.  Append returns the index of the new record.
+func (a *Appender) Append(values map[string]interface{}) (int64, error) {
+	h := a.f.Header
+	for v, vals := range values {
+		vv := h.varByName(v)
+		if vv == nil {
+			return 0, ErrUnknownVariable
+		}
+		if !vv.isRecordVariable() {
+			return 0, errNotRecordVariable
+		}
+		dt := dataTypeFromValues(vals)
+		if dt != vv.dtype && !((dt == _CHAR || dt == _BYTE) && (vv.dtype == _CHAR || vv.dtype == _BYTE)) {
+			return 0, badValueType
+		}
+		n := 1
+		for _, l := range vv.lengths[1:] {
+			n *= l
+		}
+		if valuesLen(vals) != n {
+			return 0, errRecordSize
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r := a.nr
+	if len(values) < h.numRecordVariables() {
+		if err := a.f.FillRecord(int(r)); err != nil {
+			return 0, err
+		}
+	}
+	for v, vals := range values {
+		vv := h.varByName(v)
+		begin := make([]int, len(vv.lengths))
+		end := make([]int, len(vv.lengths))
+		begin[0], end[0] = int(r), int(r)
+		for i := 1; i < len(end); i++ {
+			end[i] = vv.lengths[i] - 1
+		}
+		s, err := a.f.linearStrider(vv, begin, end)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := typedStrider(s, vv.dtype).Write(vals); n != valuesLen(vals) {
+			return 0, err
+		}
+	}
+
+	if err := writeNumRecs(a.f.rw, h.version, r+1); err != nil {
+		return 0, err
+	}
+	a.nr++
+	atomic.StoreInt64(&a.f.numrecs, a.nr)
+	return r, nil
+}
+
+func (h *Header) numRecordVariables() (n int) {
+	for i := range h.vars {
+		if h.vars[i].isRecordVariable() {
+			n++
+		}
+	}
+	return n
+}
+
+// valuesLen returns the number of elements of a slice or string accepted by Writer.
+func valuesLen(vals interface{}) int {
+	if s, ok := vals.(string); ok {
+		return len(s)
+	}
+	return attrLen(vals)
+}
@@ -0,0 +1,114 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAppender(t *testing.T) {
+	h := NewHeader([]string{"time", "x"}, []int{0, 3})
+	h.AddVariable("x", []string{"x"}, []float32{})
+	h.AddVariable("a", []string{"time", "x"}, []int16{})
+	h.AddVariable("b", []string{"time"}, []float64{})
+	h.AddVariable("c", []string{"time", "x"}, "")
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+
+	a, err := f.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.NumRecs() != 0 {
+		t.Error("initial records:", a.NumRecs())
+	}
+
+	for _, tc := range []struct {
+		values map[string]interface{}
+		err    error
+	}{
+		{map[string]interface{}{"y": []int16{1, 2, 3}}, ErrUnknownVariable},
+		{map[string]interface{}{"x": []float32{1, 2, 3}}, errNotRecordVariable},
+		{map[string]interface{}{"a": []int16{1, 2}}, errRecordSize},
+		{map[string]interface{}{"a": []int32{1, 2, 3}}, badValueType},
+	} {
+		if _, err := a.Append(tc.values); err != tc.err {
+			t.Errorf("%v: got %v, expected %v", tc.values, err, tc.err)
+		}
+	}
+
+	// every producer appends records with a = {p, i, 0}, b = p*100+i and leaves c to be filled.
+	const P, N = 4, 25
+	var wg sync.WaitGroup
+	for p := 0; p < P; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				if _, err := a.Append(map[string]interface{}{
+					"a": []int16{int16(p), int16(i), 0},
+					"b": []float64{float64(p*100 + i)},
+				}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if nr, err := readNumRecs(f.rw); nr != P*N || err != nil {
+		t.Error("numrecs:", nr, err)
+	}
+	if a.NumRecs() != P*N {
+		t.Error("records:", a.NumRecs())
+	}
+
+	av := make([]int16, 3*P*N)
+	if n, _ := mustReader(t, f, "a", nil, []int{P*N - 1, 2}).Read(av); n != len(av) {
+		t.Fatal("reading a:", n)
+	}
+	bv := make([]float64, P*N)
+	if n, _ := mustReader(t, f, "b", nil, []int{P*N - 1}).Read(bv); n != len(bv) {
+		t.Fatal("reading b:", n)
+	}
+	cv := make([]int8, 3*P*N)
+	if n, _ := mustReader(t, f, "c", nil, []int{P*N - 1, 2}).Read(cv); n != len(cv) {
+		t.Fatal("reading c:", n)
+	}
+	seen := make(map[float64]bool)
+	for r := range bv {
+		if bv[r] != float64(av[3*r])*100+float64(av[3*r+1]) || seen[bv[r]] {
+			t.Errorf("record %d: a = %v, b = %v", r, av[3*r:3*r+3], bv[r])
+		}
+		seen[bv[r]] = true
+	}
+	for _, c := range cv {
+		if c != 0 {
+			t.Fatal("c was not filled:", cv)
+		}
+	}
+
+	// a second Appender continues where the first left off.
+	a, err = f.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := a.Append(map[string]interface{}{"c": "xyz"}); r != P*N || err != nil {
+		t.Error("appending c:", r, err)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the block cache for any storage.
+
+package cdf
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// A Cache is a ReaderWriterAt that keeps the most recently used blocks of another ReaderWriterAt
+// in memory.  Opening or creating a File on a Cache turns the many small ReadAts of a strider,
+// such as those for the records of a record variable, which are interleaved with the other
+// record variables, into few large ones of whole blocks.
+//
+// The blocks missing for a ReadAt are read with one ReadAt each.  When the blocks are read in order,
+// as by the strider of a non-record variable, or of a record variable whose records fit in a block,
+// the next ReadAhead blocks are read with the missing one, with a single ReadAt.  The block size
+// should therefore be larger than the size of a record of all variables.
+//
+// WriteAt only modifies the blocks in the cache, reading a block first unless it is overwritten
+// completely.  The modified blocks are written back when they are evicted and by Flush, which must
+// be called before the underlying storage is closed or used directly.
+//
+// Readers of a File on a Cache of an Mmap copy straight from the mapping, as long as nothing
+// has been written to the cache.
+//
+// The calls of a Cache are safe for concurrent use, but they are serialized, including the
+// reads and writes of the underlying storage.
+type Cache struct {
+	// ReadAhead is the number of blocks read ahead of sequential reads, at most the number
+	// of blocks in the cache minus one.  NewCache sets it to 4.
+	ReadAhead int
+
+	rw        ReaderWriterAt
+	blockSize int64
+	capacity  int
+
+	mu     sync.Mutex
+	end    int64 // end of the data written through the cache
+	blocks map[int64]*cacheBlock
+	lru    list.List // of *cacheBlock, most recently used first
+	last   int64     // index of the block read last
+}
+
+// a cacheBlock is a block of the underlying storage.
+type cacheBlock struct {
+	index int64
+	data  []byte // up to the end of the file, with a capacity of the block size
+	dirty bool
+	elem  *list.Element
+}
+
+// NewCache returns a Cache of rw with room for the given number of blocks of blockSize bytes.
+func NewCache(rw ReaderWriterAt, blockSize int64, blocks int) (*Cache, error) {
+	if blockSize <= 0 || blocks <= 0 {
+		return nil, fmt.Errorf("invalid block size %d or cache size %d", blockSize, blocks)
+	}
+	return &Cache{
+		ReadAhead: 4,
+		rw:        rw,
+		blockSize: blockSize,
+		capacity:  blocks,
+		blocks:    make(map[int64]*cacheBlock),
+		last:      -1,
+	}, nil
+}
+
+// Size returns the size of the storage including the data written to the cache, if the underlying
+// storage has a Stat or Size method, or -1 otherwise.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size, ok := storageSize(c.rw)
+	if !ok {
+		return -1
+	}
+	if size < c.end {
+		size = c.end
+	}
+	return size
+}
+
+// mapped returns the mapping of the underlying storage if it is mapped into memory, as long
+// as nothing has been written to the cache, so that Readers can still copy from the mapping.
+func (c *Cache) mapped() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.rw.(mapper); ok && c.end == 0 {
+		return m.mapped()
+	}
+	return nil
+}
+
+// ReadAt reads len(p) bytes at offset off from the cache, reading the missing blocks
+// from the underlying storage.  It returns io.EOF if fewer bytes are read because the file ends.
+func (c *Cache) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		b, err := c.block(pos/c.blockSize, true)
+		if err != nil {
+			return n, err
+		}
+		boff := b.index * c.blockSize
+		if c.end > boff+int64(len(b.data)) {
+			b.grow(min(c.blockSize, c.end-boff))
+		}
+		lo := pos - boff
+		if lo < int64(len(b.data)) {
+			n += copy(p[n:], b.data[lo:])
+		}
+		if err := c.trim(); err != nil {
+			return n, err
+		}
+		if n < len(p) && int64(len(b.data)) < c.blockSize {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// WriteAt writes p to the blocks in the cache at offset off.  The blocks are written to the
+// underlying storage when they are evicted or flushed, which may return an error later.
+func (c *Cache) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		i := pos / c.blockSize
+		lo := pos - i*c.blockSize
+		k := min(int64(len(p)-n), c.blockSize-lo)
+		var b *cacheBlock
+		if lo == 0 && k == c.blockSize && c.blocks[i] == nil {
+			b = c.insert(i, make([]byte, 0, c.blockSize))
+		} else {
+			var err error
+			if b, err = c.block(i, false); err != nil {
+				return n, err
+			}
+		}
+		b.grow(lo + k)
+		copy(b.data[lo:], p[n:n+int(k)])
+		b.dirty = true
+		n += int(k)
+		if pos+k > c.end {
+			c.end = pos + k
+		}
+		if err := c.trim(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the modified blocks to the underlying storage, adjacent blocks with a single WriteAt.
+func (c *Cache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var dirty []*cacheBlock
+	for _, b := range c.blocks {
+		if b.dirty {
+			dirty = append(dirty, b)
+		}
+	}
+	sort.Slice(dirty, func(i, j int) bool { return dirty[i].index < dirty[j].index })
+
+	var buf []byte
+	for len(dirty) > 0 {
+		k := 1
+		for k < len(dirty) && dirty[k].index == dirty[k-1].index+1 && int64(len(dirty[k-1].data)) == c.blockSize {
+			k++
+		}
+		data := dirty[0].data
+		if k > 1 {
+			buf = buf[:0]
+			for _, b := range dirty[:k] {
+				buf = append(buf, b.data...)
+			}
+			data = buf
+		}
+		if _, err := c.rw.WriteAt(data, dirty[0].index*c.blockSize); err != nil {
+			return err
+		}
+		for _, b := range dirty[:k] {
+			b.dirty = false
+		}
+		dirty = dirty[k:]
+	}
+	return nil
+}
+
+// block returns block i, from the cache or read from the underlying storage.  If ahead is set
+// and i follows the block read last, the next blocks that are not in the cache are read too.
+func (c *Cache) block(i int64, ahead bool) (*cacheBlock, error) {
+	seq := ahead && i == c.last+1
+	if ahead {
+		c.last = i
+	}
+	if b := c.blocks[i]; b != nil {
+		c.lru.MoveToFront(b.elem)
+		return b, nil
+	}
+
+	k := int64(1)
+	if seq {
+		for k <= int64(c.ReadAhead) && k < int64(c.capacity) && c.blocks[i+k] == nil {
+			k++
+		}
+	}
+	buf := make([]byte, k*c.blockSize)
+	n, err := c.rw.ReadAt(buf, i*c.blockSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// insert the read ahead blocks first, so that block i is the most recently used.
+	for j := k - 1; j >= 0; j-- {
+		lo := j * c.blockSize
+		hi := min(lo+c.blockSize, max(int64(n), lo))
+		c.insert(i+j, buf[lo:hi:lo+c.blockSize])
+	}
+	return c.blocks[i], nil
+}
+
+// insert adds block i with data to the cache, as the most recently used.
+func (c *Cache) insert(i int64, data []byte) *cacheBlock {
+	b := &cacheBlock{index: i, data: data}
+	b.elem = c.lru.PushFront(b)
+	c.blocks[i] = b
+	return b
+}
+
+// trim evicts the least recently used blocks until the cache holds at most its capacity,
+// writing back the modified ones.  If a write fails, the block stays in the cache.
+func (c *Cache) trim() error {
+	for c.lru.Len() > c.capacity {
+		b := c.lru.Back().Value.(*cacheBlock)
+		if b.dirty {
+			if _, err := c.rw.WriteAt(b.data, b.index*c.blockSize); err != nil {
+				return err
+			}
+		}
+		c.lru.Remove(b.elem)
+		delete(c.blocks, b.index)
+	}
+	return nil
+}
+
+// grow extends the data of b with zeros to n bytes, for the holes in the file before
+// the data written to the cache.
+func (b *cacheBlock) grow(n int64) {
+	if l := int64(len(b.data)); l < n {
+		b.data = b.data[:n]
+		clear(b.data[l:])
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// a memStorage is a ReaderWriterAt in memory that counts the calls.
+type memStorage struct {
+	data          []byte
+	reads, writes int
+}
+
+func (m *memStorage) Size() int64 { return int64(len(m.data)) }
+
+func (m *memStorage) ReadAt(p []byte, off int64) (int, error) {
+	m.reads++
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *memStorage) WriteAt(p []byte, off int64) (int, error) {
+	m.writes++
+	if end := off + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+func TestCache(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 200)
+	rnd.Read(data)
+	ref := &memStorage{data: append([]byte(nil), data...)}
+	m := &memStorage{data: append([]byte(nil), data...)}
+	c, err := NewCache(m, 16, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// random reads and writes, partly past the end, must match those without the cache.
+	for i := 0; i < 2000; i++ {
+		off := rnd.Int63n(300)
+		p, q := make([]byte, rnd.Intn(50)), make([]byte, 0)
+		q = append(q, p...)
+		if rnd.Intn(3) == 0 {
+			rnd.Read(p)
+			copy(q, p)
+			n, err := c.WriteAt(p, off)
+			nn, err2 := ref.WriteAt(q, off)
+			if n != nn || err != err2 {
+				t.Fatalf("%d: WriteAt(%d, %d): %d %v, expected %d %v", i, len(p), off, n, err, nn, err2)
+			}
+			continue
+		}
+		n, err := c.ReadAt(p, off)
+		nn, err2 := ref.ReadAt(q, off)
+		if n != nn || err != err2 || !bytes.Equal(p[:n], q[:nn]) {
+			t.Fatalf("%d: ReadAt(%d, %d): %d %v %v, expected %d %v %v", i, len(p), off, n, err, p[:n], nn, err2, q[:nn])
+		}
+		if c.Size() != ref.Size() {
+			t.Fatalf("%d: size %d, expected %d", i, c.Size(), ref.Size())
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.data, ref.data) {
+		t.Errorf("flushed\n%v\nexpected\n%v", m.data, ref.data)
+	}
+
+	// nothing is written before eviction or Flush
+	m.writes = 0
+	c.WriteAt([]byte{1, 2, 3}, 5)
+	if m.writes != 0 || m.data[5] == 1 {
+		t.Error("written through")
+	}
+	c.Flush()
+	c.Flush()
+	if m.writes != 1 || !bytes.Equal(m.data[5:8], []byte{1, 2, 3}) {
+		t.Error("flushed", m.writes, m.data[5:8])
+	}
+
+	if _, err := c.ReadAt(make([]byte, 1), -1); err != errNegativeOffset {
+		t.Error("negative offset:", err)
+	}
+	if _, err := NewCache(m, 0, 1); err == nil {
+		t.Error("expected error for block size 0")
+	}
+}
+
+func TestCacheReadAhead(t *testing.T) {
+	m := &memStorage{data: make([]byte, 64*100)}
+	for i := range m.data {
+		m.data[i] = byte(i / 64)
+	}
+	c, _ := NewCache(m, 64, 8)
+
+	// sequential reads of 10 bytes read blocks 0-4, 5-9, ...
+	p := make([]byte, 10)
+	for off := int64(0); off < int64(len(m.data)); off += 10 {
+		if _, err := c.ReadAt(p, off); err != nil && err != io.EOF || p[0] != byte(off/64) {
+			t.Fatal(off, err, p[0])
+		}
+	}
+	if m.reads != 20 {
+		t.Error("sequential reads:", m.reads)
+	}
+
+	// so do the strided reads of a record variable with records smaller than a block.
+	m.reads = 0
+	c, _ = NewCache(m, 64, 8)
+	for off := int64(0); off < int64(len(m.data)); off += 48 {
+		if _, err := c.ReadAt(p[:4], off); err != nil || p[0] != byte(off/64) {
+			t.Fatal(off, err, p[0])
+		}
+	}
+	if m.reads != 20 {
+		t.Error("strided reads:", m.reads)
+	}
+
+	// no read ahead for random reads
+	m.reads = 0
+	c, _ = NewCache(m, 64, 8)
+	for _, i := range []int64{50, 3, 40, 20, 21, 99, 98} {
+		c.ReadAt(p[:1], i*64)
+	}
+	if m.reads != 7 {
+		t.Error("random reads:", m.reads)
+	}
+}
+
+func TestCacheFile(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+	c, err := NewCache(f.rw, 64, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cf.NumRecs() != 4 {
+		t.Error("numrecs", cf.NumRecs())
+	}
+	for _, tc := range []struct {
+		v                    string
+		start, count, stride []int
+	}{
+		{"g", nil, nil, nil},
+		{"f", []int{1, 0, 1}, []int{-1, 2, 2}, []int{1, 3, 3}},
+		{"h", nil, nil, nil},
+	} {
+		a, _ := f.StridedReader(tc.v, tc.start, tc.count, tc.stride)
+		b, _ := cf.StridedReader(tc.v, tc.start, tc.count, tc.stride)
+		x, y := a.Zero(200), b.Zero(200)
+		n, err := a.Read(x)
+		nn, err2 := b.Read(y)
+		if n != nn || err != err2 || !reflect.DeepEqual(x, y) {
+			t.Errorf("%v: cached read %d %v %v, expected %d %v %v", tc, nn, err2, y, n, err, x)
+		}
+	}
+
+	// append a record through the cache
+	a, err := cf.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Append(map[string]interface{}{"h": []float64{4}}); err != nil {
+		t.Fatal(err)
+	}
+	if cf.NumRecs() != 5 || f.NumRecs() != 4 {
+		t.Error("numrecs before flush", cf.NumRecs(), f.NumRecs())
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Open(f.rw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, _ := ReadVar[float64](g, "h", nil, nil)
+	if !reflect.DeepEqual(x, []float64{0, 1, 2, 3, 4}) {
+		t.Error("flushed h:", x)
+	}
+}
+
+func TestCacheMapped(t *testing.T) {
+	m := &mappedStorage{memStorage{data: make([]byte, 64)}}
+	m.data[8] = 1
+	c, _ := NewCache(m, 16, 2)
+
+	// read from the mapping, then from the cache once it has been written to.
+	x := make([]int8, 8)
+	if n, _ := newStrider(c, 8, 16, 8, nil, nil).readElems(1, x); n != 8 || x[0] != 1 || m.reads != 0 {
+		t.Error("mapped read:", n, x, m.reads)
+	}
+	c.WriteAt([]byte{2}, 8)
+	if n, _ := newStrider(c, 8, 16, 8, nil, nil).readElems(1, x); n != 8 || x[0] != 2 || m.reads != 1 {
+		t.Error("cached read:", n, x, m.reads)
+	}
+}
+
+// benchmarkReadAll reads all variables of the file of createBenchFile, from memory with or without
+// a cache, and reports the number of reads of the storage.
+func benchmarkReadAll(b *testing.B, cache bool) {
+	f, cleanup := createBenchFile(b)
+	defer cleanup()
+	data, err := io.ReadAll(io.NewSectionReader(f.rw, 0, 1<<30))
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := &memStorage{data: data}
+	var size int64
+	for _, v := range f.Header.Variables() {
+		size += f.Header.varByName(v).vSize() * f.NumRecs()
+	}
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var rw ReaderWriterAt = m
+		if cache {
+			// a new cache every time, to measure reading the storage rather than the cache.
+			rw, _ = NewCache(m, 1<<16, 64)
+		}
+		g, err := Open(rw)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, v := range g.Header.Variables() {
+			r, _ := g.Reader(v, nil, nil)
+			vv := g.Header.varByName(v)
+			values := r.Zero(int(vv.vSize() / int64(vv.dtype.storageSize()) * g.NumRecs()))
+			if _, err := r.Read(values); err != nil && err != io.EOF {
+				b.Fatal(v, err)
+			}
+		}
+	}
+	b.ReportMetric(float64(m.reads)/float64(b.N), "reads/op")
+}
+
+func BenchmarkReadAllMemory(b *testing.B) { benchmarkReadAll(b, false) }
+func BenchmarkReadAllCache(b *testing.B)  { benchmarkReadAll(b, true) }
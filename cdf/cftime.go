@@ -0,0 +1,365 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the decoding and encoding of time coordinates, following the CF conventions
+//	http://cfconventions.org/Data/cf-conventions/cf-conventions-1.6/build/cf-conventions.html#time-coordinate
+
+package cdf
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errTimeUnits = errors.New("invalid time units")
+	errCalendar  = errors.New("unsupported calendar")
+)
+
+// A calendar converts between dates and day numbers.
+type calendar int
+
+const (
+	_STANDARD calendar = iota // julian before 1582-10-15, gregorian after
+	_PROLEPTIC_GREGORIAN
+	_JULIAN
+	_NOLEAP
+	_ALL_LEAP
+	_360_DAY
+)
+
+var calendarNames = map[string]calendar{
+	"":                    _STANDARD,
+	"standard":            _STANDARD,
+	"gregorian":           _STANDARD,
+	"proleptic_gregorian": _PROLEPTIC_GREGORIAN,
+	"julian":              _JULIAN,
+	"noleap":              _NOLEAP,
+	"365_day":             _NOLEAP,
+	"all_leap":            _ALL_LEAP,
+	"366_day":             _ALL_LEAP,
+	"360_day":             _360_DAY,
+}
+
+// days before the first of the month in a year without and with leap day.
+var (
+	cumDays     = [13]int64{0, 31, 59, 90, 120, 151, 181, 212, 243, 273, 304, 334, 365}
+	cumLeapDays = [13]int64{0, 31, 60, 91, 121, 152, 182, 213, 244, 274, 305, 335, 366}
+)
+
+// the day numbers of 1582-10-15 in the gregorian calendar, the first day
+// after 1582-10-04 in the julian calendar.
+const gregorianStart = 2299161
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// days returns the day number of the date y-m-d.  For the standard, proleptic_gregorian
+// and julian calendars this is the Julian Day Number.
+func (c calendar) days(y, m, d int64) int64 {
+	switch c {
+	case _NOLEAP:
+		return 365*y + cumDays[m-1] + d - 1
+	case _ALL_LEAP:
+		return 366*y + cumLeapDays[m-1] + d - 1
+	case _360_DAY:
+		return 360*y + 30*(m-1) + d - 1
+	case _STANDARD:
+		if y < 1582 || y == 1582 && (m < 10 || m == 10 && d < 15) {
+			return _JULIAN.days(y, m, d)
+		}
+	}
+
+	// count from march 1st, year 0, so the leap day is the last day of the year.
+	if m <= 2 {
+		y--
+	}
+	mp := (m + 9) % 12
+	doy := (153*mp+2)/5 + d - 1
+
+	if c == _JULIAN {
+		era := floorDiv(y, 4)
+		yoe := y - era*4
+		return era*1461 + yoe*365 + doy + 1721118
+	}
+	era := floorDiv(y, 400)
+	yoe := y - era*400
+	return era*146097 + yoe*365 + yoe/4 - yoe/100 + doy + 1721120
+}
+
+// date is the inverse of days.
+func (c calendar) date(n int64) (y, m, d int64) {
+	switch c {
+	case _NOLEAP, _ALL_LEAP:
+		cum, ylen := &cumDays, int64(365)
+		if c == _ALL_LEAP {
+			cum, ylen = &cumLeapDays, 366
+		}
+		y = floorDiv(n, ylen)
+		doy := n - y*ylen
+		for m = 1; cum[m] <= doy; m++ {
+		}
+		return y, m, doy - cum[m-1] + 1
+	case _360_DAY:
+		y = floorDiv(n, 360)
+		doy := n - y*360
+		return y, doy/30 + 1, doy%30 + 1
+	case _STANDARD:
+		if n < gregorianStart {
+			return _JULIAN.date(n)
+		}
+	}
+
+	var doy int64
+	if c == _JULIAN {
+		z := n - 1721118
+		era := floorDiv(z, 1461)
+		doe := z - era*1461
+		yoe := (doe - doe/1460) / 365
+		y, doy = era*4+yoe, doe-365*yoe
+	} else {
+		z := n - 1721120
+		era := floorDiv(z, 146097)
+		doe := z - era*146097
+		yoe := (doe - doe/1460 + doe/36524 - doe/146096) / 365
+		y, doy = era*400+yoe, doe-(365*yoe+yoe/4-yoe/100)
+	}
+	mp := (5*doy + 2) / 153
+	d = doy - (153*mp+2)/5 + 1
+	m = (mp+2)%12 + 1
+	if m <= 2 {
+		y++
+	}
+	return y, m, d
+}
+
+// TimeUnits converts between the values of a time coordinate and time.Time.
+type TimeUnits struct {
+	cal   calendar
+	unit  float64 // in seconds
+	epoch int64   // day number
+	secs  float64 // seconds since 00:00 UTC on the epoch day
+}
+
+var unitSeconds = map[string]float64{
+	"microseconds": 1e-6, "microsecond": 1e-6, "us": 1e-6,
+	"milliseconds": 1e-3, "millisecond": 1e-3, "msec": 1e-3, "ms": 1e-3,
+	"seconds": 1, "second": 1, "secs": 1, "sec": 1, "s": 1,
+	"minutes": 60, "minute": 60, "mins": 60, "min": 60,
+	"hours": 3600, "hour": 3600, "hrs": 3600, "hr": 3600, "h": 3600,
+	"days": 86400, "day": 86400, "d": 86400,
+}
+
+// ParseTimeUnits parses a units attribute of the form "<unit> since <date> [<time> [<zone>]]",
+// e.g. "hours since 1970-01-01 00:00:00" and a calendar attribute, which can be empty or
+// one of "standard", "gregorian", "proleptic_gregorian", "julian", "noleap", "365_day",
+// "all_leap", "366_day" or "360_day".  The units can be microseconds, milliseconds, seconds,
+// minutes, hours or days, or their common abbreviations; the ill-defined months and years are not supported.
+func ParseTimeUnits(units, cal string) (*TimeUnits, error) {
+	c, ok := calendarNames[strings.ToLower(cal)]
+	if !ok {
+		return nil, errCalendar
+	}
+	u := &TimeUnits{cal: c}
+
+	f := strings.Fields(units)
+	if len(f) < 3 || strings.ToLower(f[1]) != "since" {
+		return nil, errTimeUnits
+	}
+	if u.unit, ok = unitSeconds[strings.ToLower(f[0])]; !ok {
+		return nil, errTimeUnits
+	}
+	f = f[2:]
+
+	// 1970-01-01T00:00:00Z is one field
+	if i := strings.IndexByte(f[0], 'T'); i > 0 {
+		f = append([]string{f[0][:i], f[0][i+1:]}, f[1:]...)
+	}
+	if len(f) > 1 && strings.HasSuffix(f[1], "Z") {
+		f[1] = strings.TrimSuffix(f[1], "Z")
+	}
+	if len(f) > 3 {
+		return nil, errTimeUnits
+	}
+
+	// the date, with an optional sign on the year
+	neg := strings.HasPrefix(f[0], "-")
+	ymd := strings.Split(strings.TrimPrefix(f[0], "-"), "-")
+	if len(ymd) != 3 {
+		return nil, errTimeUnits
+	}
+	var date [3]int64
+	for i, s := range ymd {
+		x, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errTimeUnits
+		}
+		date[i] = x
+	}
+	if neg {
+		date[0] = -date[0]
+	}
+	if date[1] < 1 || date[1] > 12 || date[2] < 1 || date[2] > 31 {
+		return nil, errTimeUnits
+	}
+	u.epoch = c.days(date[0], date[1], date[2])
+
+	// the time of day, which may be followed by the zone without a space.
+	if len(f) > 1 {
+		tod := f[1]
+		if i := strings.IndexAny(tod, "+-"); i > 0 && len(f) == 2 {
+			f = append(f, tod[i:])
+			tod = tod[:i]
+		}
+		hms := strings.Split(tod, ":")
+		if len(hms) > 3 {
+			return nil, errTimeUnits
+		}
+		for i, s := range hms {
+			x, err := strconv.ParseFloat(s, 64)
+			if err != nil || x < 0 {
+				return nil, errTimeUnits
+			}
+			u.secs += x * []float64{3600, 60, 1}[i]
+		}
+	}
+
+	// the zone: +hh[:mm], +hhmm, UTC or Z.
+	if len(f) > 2 {
+		switch z := strings.ToUpper(f[2]); {
+		case z == "UTC" || z == "Z" || z == "GMT":
+		case z[0] == '+' || z[0] == '-':
+			hm := strings.Split(z[1:], ":")
+			if len(hm) == 1 && len(hm[0]) == 4 {
+				hm = []string{hm[0][:2], hm[0][2:]}
+			}
+			var off float64
+			for i, s := range hm {
+				x, err := strconv.ParseUint(s, 10, 8)
+				if err != nil || i > 1 {
+					return nil, errTimeUnits
+				}
+				off += float64(x) * []float64{3600, 60}[i]
+			}
+			if z[0] == '+' {
+				off = -off
+			}
+			u.secs += off
+		default:
+			return nil, errTimeUnits
+		}
+	}
+
+	return u, nil
+}
+
+// Time returns the instant at x units since the epoch, in UTC.
+//
+// In calendars other than proleptic_gregorian, the returned time has the year, month, day and time
+// of day of the date in the calendar, so for the standard calendar dates before 1582-10-15 are julian
+// dates, and in the 360_day calendar February 29 and 30 are normalized to March 1 and 2 of the gregorian calendar.
+func (u *TimeUnits) Time(x float64) time.Time {
+	s := u.secs + x*u.unit
+	days := math.Floor(s / 86400)
+	y, m, d := u.cal.date(u.epoch + int64(days))
+	ns := time.Duration(math.Floor((s-days*86400)*1e9 + .5))
+	return time.Date(int(y), time.Month(m), int(d), 0, 0, 0, 0, time.UTC).Add(ns)
+}
+
+// Value returns t as units since the epoch.  It is the inverse of Time: the date of t in UTC is interpreted
+// as a date in the calendar.
+func (u *TimeUnits) Value(t time.Time) float64 {
+	t = t.UTC()
+	y, m, d := t.Date()
+	days := u.cal.days(int64(y), int64(m), int64(d)) - u.epoch
+	tod := float64(t.Hour()*3600+t.Minute()*60+t.Second()) + float64(t.Nanosecond())/1e9
+	return (float64(days)*86400 + tod - u.secs) / u.unit
+}
+
+// TimeUnits returns the TimeUnits for variable v from its units and calendar attributes.
+func (h *Header) TimeUnits(v string) (*TimeUnits, error) {
+	if h.varByName(v) == nil {
+		return nil, ErrUnknownVariable
+	}
+	units, _ := h.GetAttribute(v, "units").(string)
+	cal, _ := h.GetAttribute(v, "calendar").(string)
+	return ParseTimeUnits(units, cal)
+}
+
+// ReadTimes reads the elements of the time coordinate v from the corner begin to end, with the same defaults
+// as File.Reader, and converts them with the TimeUnits of v.  Missing values are returned as the zero time.Time.
+func (f *File) ReadTimes(v string, begin, end []int) ([]time.Time, error) {
+	u, err := f.Header.TimeUnits(v)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.MaskedReader(v, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	var times []time.Time
+	buf := make([]float64, 1024)
+	for {
+		n, err := r.Read(buf, nil)
+		for _, x := range buf[:n] {
+			if math.IsNaN(x) {
+				times = append(times, time.Time{})
+			} else {
+				times = append(times, u.Time(x))
+			}
+		}
+		if err == io.EOF {
+			return times, nil
+		}
+		if err != nil {
+			return times, err
+		}
+	}
+}
+
+// WriteTimes converts times with the TimeUnits of the time coordinate v and writes them starting at
+// the corner begin, with the same defaults as File.Writer.  Zero times are written as the fill value.
+// It returns the number of elements written.
+func (f *File) WriteTimes(v string, begin []int, times []time.Time) (int, error) {
+	u, err := f.Header.TimeUnits(v)
+	if err != nil {
+		return 0, err
+	}
+	w, err := f.PackingWriter(v, begin, nil)
+	if err != nil {
+		return 0, err
+	}
+	x := make([]float64, len(times))
+	for i, t := range times {
+		if t.IsZero() {
+			x[i] = math.NaN()
+		} else {
+			x[i] = u.Value(t)
+		}
+	}
+	n, err := w.Write(x)
+	if n == len(x) {
+		err = nil
+	}
+	return n, err
+}
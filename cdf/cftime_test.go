@@ -0,0 +1,108 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarDays(t *testing.T) {
+	for c := _STANDARD; c <= _360_DAY; c++ {
+		for n := int64(-800000); n < 3000000; n += 97 {
+			y, m, d := c.date(n)
+			if nn := c.days(y, m, d); nn != n {
+				t.Fatalf("calendar %d: %d -> %d-%d-%d -> %d", c, n, y, m, d, nn)
+			}
+		}
+	}
+
+	if n := _PROLEPTIC_GREGORIAN.days(1970, 1, 1); n != 2440588 {
+		t.Error("JDN of 1970-01-01:", n)
+	}
+	if n := _STANDARD.days(1582, 10, 4); n != gregorianStart-1 {
+		t.Error("JDN of 1582-10-04:", n)
+	}
+}
+
+func TestTimeUnits(t *testing.T) {
+	for _, tc := range []struct {
+		units, cal string
+		x          float64
+		exp        string
+	}{
+		{"hours since 1970-01-01 00:00:00", "", 36, "1970-01-02T12:00:00Z"},
+		{"seconds since 1970-01-01T00:00:00Z", "gregorian", 1.5, "1970-01-01T00:00:01.5Z"},
+		{"minutes since 2000-01-01 06:00 +06:00", "standard", 30, "2000-01-01T00:30:00Z"},
+		{"days since 1582-10-04", "standard", 1, "1582-10-15T00:00:00Z"},
+		{"days since 1582-10-04", "proleptic_gregorian", 1, "1582-10-05T00:00:00Z"},
+		{"days since 1900-01-01", "julian", 60, "1900-03-01T00:00:00Z"},
+		{"days since 2000-01-01", "noleap", 59, "2000-03-01T00:00:00Z"},
+		{"days since 2000-01-01", "365_day", 365, "2001-01-01T00:00:00Z"},
+		{"days since 2001-01-01", "all_leap", 60, "2001-03-01T00:00:00Z"},
+		{"days since 2000-01-01", "360_day", 30, "2000-02-01T00:00:00Z"},
+		{"days since 2000-01-01", "360_day", -1, "1999-12-30T00:00:00Z"},
+		{"days since 2000-01-01", "360_day", 360, "2001-01-01T00:00:00Z"},
+	} {
+		u, err := ParseTimeUnits(tc.units, tc.cal)
+		if err != nil {
+			t.Error(tc.units, err)
+			continue
+		}
+		tm := u.Time(tc.x)
+		if s := tm.Format(time.RFC3339Nano); s != tc.exp {
+			t.Errorf("%s (%s) %v: got %s, expected %s", tc.units, tc.cal, tc.x, s, tc.exp)
+		}
+		if x := u.Value(tm); x != tc.x {
+			t.Errorf("%s (%s) %v: got back %v", tc.units, tc.cal, tc.x, x)
+		}
+	}
+
+	for _, s := range []string{"", "days", "days after 2000-01-01", "months since 2000-01-01", "days since 2000-13-01", "days since 2000-01-01 00:00 CET"} {
+		if _, err := ParseTimeUnits(s, ""); err != errTimeUnits {
+			t.Errorf("%q: expected errTimeUnits, got %v", s, err)
+		}
+	}
+	if _, err := ParseTimeUnits("days since 2000-01-01", "mayan"); err != errCalendar {
+		t.Error("expected errCalendar, got", err)
+	}
+}
+
+func TestReadWriteTimes(t *testing.T) {
+	h := NewHeader([]string{"time"}, []int{0})
+	h.AddVariable("time", []string{"time"}, []int32{})
+	h.AddAttribute("time", "units", "hours since 2000-01-01")
+	h.AddAttribute("time", "calendar", "noleap")
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+
+	t0 := time.Date(2000, 2, 28, 12, 0, 0, 0, time.UTC)
+	times := []time.Time{t0, {}, t0.Add(48 * time.Hour)} // no February 29
+	if n, err := f.WriteTimes("time", nil, times); n != 3 || err != nil {
+		t.Fatal("writing times:", n, err)
+	}
+
+	var raw [3]int32
+	if n, _ := mustReader(t, f, "time", nil, []int{2}).Read(raw[:]); n != 3 || raw != [3]int32{1404, -2147483647, 1428} {
+		t.Error("raw times:", n, raw)
+	}
+
+	got, err := f.ReadTimes("time", nil, nil)
+	if err != nil || len(got) != 3 || !got[0].Equal(t0) || !got[1].IsZero() || !got[2].Equal(times[2]) {
+		t.Error("reading times:", got, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the conversion between big-endian CDF data and Go slices.
+
+package cdf
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// nativeBigEndian is whether the host stores numbers big-endian, like CDF.
+var nativeBigEndian = binary.NativeEndian.Uint16([]byte{1, 2}) == 0x102
+
+// asBytes returns the memory of the elements of values as a byte slice, so that big-endian
+// data can be read straight into it and then converted with fromBigEndian.
+func asBytes[T Elem](values []T) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&values[0])), len(values)*int(unsafe.Sizeof(values[0])))
+}
+
+// elemBytes is asBytes for a slice of any of the supported types, or nil.
+func elemBytes(values interface{}) []byte {
+	switch vv := values.(type) {
+	case []int8:
+		return asBytes(vv)
+	case []int16:
+		return asBytes(vv)
+	case []int32:
+		return asBytes(vv)
+	case []float32:
+		return asBytes(vv)
+	case []float64:
+		return asBytes(vv)
+	case []uint8:
+		return asBytes(vv)
+	case []uint16:
+		return asBytes(vv)
+	case []uint32:
+		return asBytes(vv)
+	case []int64:
+		return asBytes(vv)
+	case []uint64:
+		return asBytes(vv)
+	}
+	return nil
+}
+
+// fromBigEndian converts the big-endian elements of size bytes in p to the byte order of the host, in place.
+func fromBigEndian(p []byte, size int) {
+	if !nativeBigEndian {
+		reorder(p, size, binary.BigEndian, binary.NativeEndian)
+	}
+}
+
+// reorder converts the elements of size bytes in p from byte order from to byte order to, in place.
+func reorder(p []byte, size int, from, to binary.ByteOrder) {
+	switch size {
+	case 2:
+		for i := 0; i+2 <= len(p); i += 2 {
+			to.PutUint16(p[i:], from.Uint16(p[i:]))
+		}
+	case 4:
+		for i := 0; i+4 <= len(p); i += 4 {
+			to.PutUint32(p[i:], from.Uint32(p[i:]))
+		}
+	case 8:
+		for i := 0; i+8 <= len(p); i += 8 {
+			to.PutUint64(p[i:], from.Uint64(p[i:]))
+		}
+	}
+}
+
+// toBigEndian copies the elements of size bytes in the byte order of the host in src to big-endian in dst.
+// len(dst) must be at least len(src).
+func toBigEndian(dst, src []byte, size int) {
+	if nativeBigEndian || size == 1 {
+		copy(dst, src)
+		return
+	}
+	be, ne := binary.BigEndian, binary.NativeEndian
+	switch size {
+	case 2:
+		for i := 0; i+2 <= len(src); i += 2 {
+			be.PutUint16(dst[i:], ne.Uint16(src[i:]))
+		}
+	case 4:
+		for i := 0; i+4 <= len(src); i += 4 {
+			be.PutUint32(dst[i:], ne.Uint32(src[i:]))
+		}
+	case 8:
+		for i := 0; i+8 <= len(src); i += 8 {
+			be.PutUint64(dst[i:], ne.Uint64(src[i:]))
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// codecValues are values of every type, including the extremes, to test the encoding.
+var codecValues = map[string]interface{}{
+	"b":  []int8{-128, -1, 0, 1, 127},
+	"s":  []int16{-32768, -2, 0, 0x102, 32767},
+	"i":  []int32{-1 << 31, -3, 0, 0x1020304, 1<<31 - 1},
+	"f":  []float32{float32(math.Inf(-1)), -1.5, 0, math.SmallestNonzeroFloat32, math.MaxFloat32},
+	"d":  []float64{math.Inf(-1), -1.5, 0, math.SmallestNonzeroFloat64, math.MaxFloat64},
+	"ub": []uint8{0, 1, 0x7f, 0x80, 0xff},
+	"us": []uint16{0, 1, 0x102, 0x8000, 0xffff},
+	"ui": []uint32{0, 1, 0x1020304, 1 << 31, 1<<32 - 1},
+	"l":  []int64{-1 << 63, -5, 0, 0x102030405060708, 1<<63 - 1},
+	"ul": []uint64{0, 1, 0x102030405060708, 1 << 63, 1<<64 - 1},
+}
+
+// codecBytes are the big-endian encodings of the third and fourth values.
+var codecBytes = map[string][]byte{
+	"b":  {0, 1},
+	"s":  {0, 0, 1, 2},
+	"i":  {0, 0, 0, 0, 1, 2, 3, 4},
+	"ub": {0x7f, 0x80},
+	"l":  {0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8},
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	h := NewHeader([]string{"n"}, []int{5})
+	for _, v := range []string{"b", "s", "i", "f", "d", "ub", "us", "ui", "l", "ul"} {
+		h.AddVariable(v, []string{"n"}, codecValues[v])
+	}
+	if err := h.DefineVersion(5); err != nil {
+		t.Fatal(err)
+	}
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+
+	for v, x := range codecValues {
+		if n, _ := mustWriter(t, f, v, nil, nil).Write(x); n != 5 {
+			t.Fatal("writing", v, n)
+		}
+	}
+	for v, x := range codecValues {
+		y := h.ZeroValue(v, 5)
+		if n, err := mustReader(t, f, v, nil, nil).Read(y); n != 5 || err != nil {
+			t.Error("reading", v, n, err)
+		}
+		if !reflect.DeepEqual(x, y) {
+			t.Errorf("%s: read %v, expected %v", v, y, x)
+		}
+
+		// the third and fourth elements are stored big-endian.
+		vv := h.varByName(v)
+		sz := int64(vv.dtype.storageSize())
+		raw := make([]byte, 2*sz)
+		if _, err := f.rw.ReadAt(raw, vv.begin+2*sz); err != nil {
+			t.Fatal(err)
+		}
+		if exp, ok := codecBytes[v]; ok && !reflect.DeepEqual(raw, exp) {
+			t.Errorf("%s: stored %v, expected %v", v, raw, exp)
+		}
+	}
+
+	// short reads and writes at the end
+	r := mustReader(t, f, "i", []int{3}, nil)
+	y := make([]int32, 4)
+	if n, err := r.Read(y); n != 2 || err != io.EOF || y[0] != 0x1020304 || y[1] != 1<<31-1 {
+		t.Error("short read:", n, err, y)
+	}
+	if n, err := mustWriter(t, f, "d", []int{4}, nil).Write([]float64{1, 2}); n != 1 || err != io.EOF {
+		t.Error("short write:", n, err)
+	}
+}
+
+// a mappedStorage is a memStorage that is read through its mapping.
+type mappedStorage struct{ memStorage }
+
+func (m *mappedStorage) mapped() []byte { return m.data }
+
+func TestCodecPartialElement(t *testing.T) {
+	h := NewHeader([]string{"n"}, []int{4})
+	h.AddVariable("i", []string{"n"}, []int32{})
+	h.Define()
+	var m mappedStorage
+	f, err := Create(&m.memStorage, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := mustWriter(t, f, "i", nil, nil).Write([]int32{1, 2, 3, 4}); n != 4 {
+		t.Fatal("writing", n)
+	}
+	// cut the storage halfway the third element
+	m.data = m.data[:h.varByName("i").begin+10]
+
+	for _, rw := range []ReaderWriterAt{&m.memStorage, &m} {
+		g := &File{rw: rw, Header: h, numrecs: -1}
+		y := []int32{7, 7, 7, 7}
+		if n, err := mustReader(t, g, "i", nil, nil).Read(y); n != 2 || err != io.EOF || !reflect.DeepEqual(y, []int32{1, 2, 0, 7}) {
+			t.Errorf("%T: read %d %v %v", rw, n, err, y)
+		}
+		r, err := NewTypedReader[int32](g, "i", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		y = []int32{7, 7, 7, 7}
+		if n, err := r.Read(y); n != 2 || err != io.EOF || !reflect.DeepEqual(y, []int32{1, 2, 0, 7}) {
+			t.Errorf("%T: typed read %d %v %v", rw, n, err, y)
+		}
+	}
+}
+
+// benchmarkCodec reads or writes a variable of 1<<16 elements of the type of zero in one call.
+func benchmarkCodec(b *testing.B, zero interface{}, write bool) {
+	const n = 1 << 16
+	h := NewHeader([]string{"n"}, []int{n})
+	h.AddVariable("v", []string{"n"}, zero)
+	h.DefineVersion(5)
+	f, cleanup := createTestFile(b, h)
+	defer cleanup()
+
+	values := h.ZeroValue("v", n)
+	w, _ := f.Writer("v", nil, nil)
+	w.Write(values)
+	b.SetBytes(int64(n * h.varByName("v").dtype.storageSize()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var k int
+		if write {
+			w, _ := f.Writer("v", nil, nil)
+			k, _ = w.Write(values)
+		} else {
+			r, _ := f.Reader("v", nil, nil)
+			k, _ = r.Read(values)
+		}
+		if k != n {
+			b.Fatal("short transfer", k)
+		}
+	}
+}
+
+func BenchmarkReadInt8(b *testing.B)     { benchmarkCodec(b, []int8{}, false) }
+func BenchmarkReadInt16(b *testing.B)    { benchmarkCodec(b, []int16{}, false) }
+func BenchmarkReadInt32(b *testing.B)    { benchmarkCodec(b, []int32{}, false) }
+func BenchmarkReadFloat32(b *testing.B)  { benchmarkCodec(b, []float32{}, false) }
+func BenchmarkReadFloat64(b *testing.B)  { benchmarkCodec(b, []float64{}, false) }
+func BenchmarkReadUint8(b *testing.B)    { benchmarkCodec(b, []uint8{}, false) }
+func BenchmarkReadUint16(b *testing.B)   { benchmarkCodec(b, []uint16{}, false) }
+func BenchmarkReadUint32(b *testing.B)   { benchmarkCodec(b, []uint32{}, false) }
+func BenchmarkReadInt64(b *testing.B)    { benchmarkCodec(b, []int64{}, false) }
+func BenchmarkReadUint64(b *testing.B)   { benchmarkCodec(b, []uint64{}, false) }
+func BenchmarkWriteInt8(b *testing.B)    { benchmarkCodec(b, []int8{}, true) }
+func BenchmarkWriteInt16(b *testing.B)   { benchmarkCodec(b, []int16{}, true) }
+func BenchmarkWriteInt32(b *testing.B)   { benchmarkCodec(b, []int32{}, true) }
+func BenchmarkWriteFloat32(b *testing.B) { benchmarkCodec(b, []float32{}, true) }
+func BenchmarkWriteFloat64(b *testing.B) { benchmarkCodec(b, []float64{}, true) }
+func BenchmarkWriteUint8(b *testing.B)   { benchmarkCodec(b, []uint8{}, true) }
+func BenchmarkWriteUint16(b *testing.B)  { benchmarkCodec(b, []uint16{}, true) }
+func BenchmarkWriteUint32(b *testing.B)  { benchmarkCodec(b, []uint32{}, true) }
+func BenchmarkWriteInt64(b *testing.B)   { benchmarkCodec(b, []int64{}, true) }
+func BenchmarkWriteUint64(b *testing.B)  { benchmarkCodec(b, []uint64{}, true) }
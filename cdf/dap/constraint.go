@@ -0,0 +1,192 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the parsing of constraint expressions.
+
+package dap
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// A projection is a variable, or the part of it in a hyperslab.
+type projection struct {
+	v                    *variable
+	start, stride, count []int // along v.dims
+}
+
+// whole returns the projection of all of v.
+func whole(v *variable) projection {
+	p := projection{v, make([]int, len(v.dims)), make([]int, len(v.dims)), append([]int(nil), v.lengths...)}
+	for i := range p.stride {
+		p.stride[i] = 1
+	}
+	return p
+}
+
+// size returns the number of elements in the projection.
+func (p projection) size() int {
+	n := 1
+	for _, c := range p.count {
+		n *= c
+	}
+	return n
+}
+
+// maps returns the projections of the maps of the grid p.v, with the hyperslab of p along their dimension.
+func (p projection) maps() []projection {
+	var pp []projection
+	for i, m := range p.v.maps {
+		pp = append(pp, projection{m, p.start[i : i+1], p.stride[i : i+1], p.count[i : i+1]})
+	}
+	return pp
+}
+
+// A field is a projection of a top level variable of the dataset.  If members is not nil,
+// it is the projection of only some of the members of the grid v, sent as a structure.
+type field struct {
+	projection
+	members []projection
+}
+
+// parseConstraint parses the constraint expression ce, the query of a request URL, and returns
+// the projected fields.  An empty expression projects all variables.  Selections are not supported.
+func parseConstraint(vars []*variable, ce string) ([]field, error) {
+	ce, err := url.PathUnescape(ce)
+	if err != nil {
+		return nil, &Error{MalformedExpr, err.Error()}
+	}
+	proj, sel, _ := strings.Cut(ce, "&")
+	if sel != "" {
+		return nil, &Error{MalformedExpr, "selections are not supported"}
+	}
+
+	var fields []field
+	if strings.TrimSpace(proj) == "" {
+		for _, v := range vars {
+			fields = append(fields, field{projection: whole(v)})
+		}
+		return fields, nil
+	}
+
+	byName := make(map[string]*variable)
+	for _, v := range vars {
+		byName[v.name] = v
+	}
+
+	for _, s := range strings.Split(proj, ",") {
+		s = strings.TrimSpace(s)
+		name, slab := s, ""
+		if i := strings.IndexByte(s, '['); i >= 0 {
+			name, slab = s[:i], s[i:]
+		}
+		gname, mname, isMember := strings.Cut(name, ".")
+		v := byName[gname]
+		if v == nil {
+			return nil, &Error{NoSuchVariable, fmt.Sprintf("no such variable: %q", name)}
+		}
+
+		if !isMember {
+			p, err := parseSlab(v, slab)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{projection: p})
+			continue
+		}
+
+		var m *variable
+		if mname == v.name {
+			m = v
+		}
+		for _, mm := range v.maps {
+			if mm.name == mname {
+				m = mm
+			}
+		}
+		if m == nil || len(v.maps) == 0 {
+			return nil, &Error{NoSuchVariable, fmt.Sprintf("no such variable: %q", name)}
+		}
+		p, err := parseSlab(m, slab)
+		if err != nil {
+			return nil, err
+		}
+
+		// members of the same grid go in one structure.
+		k := -1
+		for i := range fields {
+			if fields[i].v == v && fields[i].members != nil {
+				k = i
+			}
+		}
+		if k < 0 {
+			k = len(fields)
+			fields = append(fields, field{projection: whole(v), members: []projection{}})
+		}
+		fields[k].members = append(fields[k].members, p)
+	}
+	return fields, nil
+}
+
+// parseSlab parses a hyperslab of the form [start:stride:stop]... with an index for every
+// dimension of v, or none for all of v.  The forms [i] and [start:stop] select a single element
+// and a range with stride 1.  Stop is inclusive.
+func parseSlab(v *variable, s string) (projection, error) {
+	p := whole(v)
+	if s == "" {
+		return p, nil
+	}
+	bad := func() (projection, error) {
+		return projection{}, &Error{MalformedExpr, fmt.Sprintf("invalid hyperslab %q for %s", s, v.name)}
+	}
+	for i := 0; s != ""; i++ {
+		if s[0] != '[' || i >= len(v.dims) {
+			return bad()
+		}
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return bad()
+		}
+		var x []int
+		for _, f := range strings.Split(s[1:end], ":") {
+			n, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || n < 0 {
+				return bad()
+			}
+			x = append(x, n)
+		}
+		start, stride, stop := x[0], 1, x[0]
+		switch len(x) {
+		case 1:
+		case 2:
+			stop = x[1]
+		case 3:
+			stride, stop = x[1], x[2]
+		default:
+			return bad()
+		}
+		if stride < 1 || stop < start || stop >= v.lengths[i] {
+			return bad()
+		}
+		p.start[i], p.stride[i], p.count[i] = start, stride, (stop-start)/stride+1
+		s = s[end+1:]
+		if s == "" && i+1 != len(v.dims) {
+			return bad()
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,491 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package dap serves NetCDF files as datasets of the DAP2 protocol of OPeNDAP, so they can be read
+remotely by tools like Panoply, xarray and the NetCDF library itself.  The protocol is specified in
+
+	http://www.opendap.org/pdf/ESE-RFC-004v1.2.pdf
+
+A Dataset writes the responses for a single cdf.File: the Dataset Attribute Structure (.das),
+the Dataset Descriptor Structure (.dds), the data in XDR encoding (.dods) and the data as
+comma separated text (.asc).  Handler serves the files of a directory tree.
+
+The variables of the file are mapped to DAP2 types as follows: BYTE to Int16, so that negative
+values survive, UBYTE to Byte, CHAR to String, where the innermost dimension is the length of
+the strings, and the other types to the DAP2 types of the same size.  The 64-bit integer types
+of the CDF-5 format have no DAP2 equivalent; variables of those types are left out, and attributes
+are sent as Float64.  A variable whose dimensions all have numeric coordinate variables is a Grid,
+with those as its maps.  Global attributes are in the NC_GLOBAL container of the DAS.
+
+Constraint expressions may project variables, optionally with a hyperslab of the form
+[start:stride:stop], [start:stop] or [index] for every dimension, and members of grids, as in
+
+	?t[0:1:3][2][0:1],lat,t.time
+
+Projected members of a grid are sent as a Structure.  Selections are not supported.
+*/
+package dap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+// A Dataset is a NetCDF file served as a DAP2 dataset.
+type Dataset struct {
+	Name    string    // the name in the DDS
+	File    *cdf.File //
+	NumRecs int64     // the number of records served
+}
+
+// NewDataset returns a Dataset for f, with the records up to f.NumRecs.
+func NewDataset(name string, f *cdf.File) *Dataset {
+	nr := f.NumRecs()
+	if nr < 0 {
+		nr = 0
+	}
+	return &Dataset{Name: name, File: f, NumRecs: nr}
+}
+
+// A variable is a variable of the file as a DAP2 array or grid.
+type variable struct {
+	name    string
+	typ     string // the DAP2 type
+	dims    []string
+	lengths []int       // of dims, with the record dimension at NumRecs
+	strlen  int         // for CHAR, the length of the strings, the innermost dimension, not in dims
+	maps    []*variable // for grids, the coordinate variables of dims
+}
+
+var dapTypes = map[reflect.Type]string{
+	reflect.TypeOf([]int8(nil)):    "Int16",
+	reflect.TypeOf([]uint8(nil)):   "Byte",
+	reflect.TypeOf([]int16(nil)):   "Int16",
+	reflect.TypeOf([]uint16(nil)):  "UInt16",
+	reflect.TypeOf([]int32(nil)):   "Int32",
+	reflect.TypeOf([]uint32(nil)):  "UInt32",
+	reflect.TypeOf([]float32(nil)): "Float32",
+	reflect.TypeOf([]float64(nil)): "Float64",
+	reflect.TypeOf(""):             "String",
+	reflect.TypeOf([]int64(nil)):   "Float64", // attributes only
+	reflect.TypeOf([]uint64(nil)):  "Float64", // attributes only
+}
+
+// variables returns the variables of the file that can be served, in the order of the header.
+func (d *Dataset) variables() []*variable {
+	h := d.File.Header
+	var vars []*variable
+	byName := make(map[string]*variable)
+	for _, name := range h.Variables() {
+		z := h.ZeroValue(name, 0)
+		switch z.(type) {
+		case []int64, []uint64:
+			continue
+		}
+		// the lengths are the header's own, and are changed for record variables.
+		lengths := append([]int(nil), h.Lengths(name)...)
+		v := &variable{name: name, typ: dapTypes[reflect.TypeOf(z)], dims: h.Dimensions(name), lengths: lengths}
+		if h.IsRecordVariable(name) {
+			v.lengths[0] = int(d.NumRecs)
+		}
+		if _, isChar := z.(string); isChar {
+			if n := len(v.dims); n > 0 {
+				v.strlen = v.lengths[n-1]
+				v.dims, v.lengths = v.dims[:n-1], v.lengths[:n-1]
+			} else {
+				v.strlen = 1
+			}
+		}
+		vars = append(vars, v)
+		byName[name] = v
+	}
+
+	for _, v := range vars {
+		if v.strlen > 0 || len(v.dims) == 0 || len(v.dims) == 1 && v.dims[0] == v.name {
+			continue
+		}
+		var maps []*variable
+		for _, dim := range v.dims {
+			if m := byName[dim]; m != nil && m.strlen == 0 && len(m.dims) == 1 && m.dims[0] == dim {
+				maps = append(maps, m)
+			}
+		}
+		if len(maps) == len(v.dims) {
+			v.maps = maps
+		}
+	}
+	return vars
+}
+
+// WriteDAS writes the Dataset Attribute Structure of d to w.
+func (d *Dataset) WriteDAS(w io.Writer) error {
+	h := d.File.Header
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "Attributes {")
+	writeAttributes(bw, h, "", "NC_GLOBAL")
+	for _, v := range d.variables() {
+		writeAttributes(bw, h, v.name, v.name)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func writeAttributes(w *bufio.Writer, h *cdf.Header, v, container string) {
+	fmt.Fprintf(w, "    %s {\n", container)
+	for _, a := range h.Attributes(v) {
+		val := h.GetAttribute(v, a)
+		typ := dapTypes[reflect.TypeOf(val)]
+		if typ == "" {
+			continue
+		}
+		var s []string
+		if str, ok := val.(string); ok {
+			s = []string{quote(strings.TrimRight(str, "\x00"))}
+		} else {
+			rv := reflect.ValueOf(val)
+			for i := 0; i < rv.Len(); i++ {
+				s = append(s, formatValue(rv.Index(i).Interface()))
+			}
+		}
+		fmt.Fprintf(w, "        %s %s %s;\n", typ, a, strings.Join(s, ", "))
+	}
+	fmt.Fprintln(w, "    }")
+}
+
+// WriteDDS writes the Dataset Descriptor Structure of the variables of d projected by the
+// constraint expression ce to w.  Errors in ce are returned as an *Error before anything is written.
+func (d *Dataset) WriteDDS(w io.Writer, ce string) error {
+	fields, err := parseConstraint(d.variables(), ce)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	d.writeDDS(bw, fields)
+	return bw.Flush()
+}
+
+func (d *Dataset) writeDDS(w *bufio.Writer, fields []field) {
+	fmt.Fprintln(w, "Dataset {")
+	for _, f := range fields {
+		switch {
+		case f.members != nil:
+			fmt.Fprintln(w, "    Structure {")
+			for _, p := range f.members {
+				fmt.Fprintf(w, "        %s;\n", p.decl())
+			}
+			fmt.Fprintf(w, "    } %s;\n", f.v.name)
+		case f.v.maps != nil:
+			fmt.Fprintln(w, "    Grid {")
+			fmt.Fprintln(w, "      ARRAY:")
+			fmt.Fprintf(w, "        %s;\n", f.decl())
+			fmt.Fprintln(w, "      MAPS:")
+			for _, p := range f.maps() {
+				fmt.Fprintf(w, "        %s;\n", p.decl())
+			}
+			fmt.Fprintf(w, "    } %s;\n", f.v.name)
+		default:
+			fmt.Fprintf(w, "    %s;\n", f.decl())
+		}
+	}
+	fmt.Fprintf(w, "} %s;\n", d.Name)
+}
+
+// decl returns the declaration of p in the DDS.
+func (p projection) decl() string {
+	s := p.v.typ + " " + p.v.name
+	for i, dim := range p.v.dims {
+		s += fmt.Sprintf("[%s = %d]", dim, p.count[i])
+	}
+	return s
+}
+
+// WriteDODS writes the DDS and the data of the variables of d projected by the constraint
+// expression ce to w, in the XDR encoding of DAP2.
+// Errors in ce are returned as an *Error before anything is written.
+func (d *Dataset) WriteDODS(w io.Writer, ce string) error {
+	fields, err := parseConstraint(d.variables(), ce)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	d.writeDDS(bw, fields)
+	bw.WriteString("\nData:\n")
+	for _, f := range fields {
+		for _, p := range f.parts() {
+			if err := d.writeXDR(bw, p); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// parts returns the projections of f in the order their data is sent.
+func (f field) parts() []projection {
+	switch {
+	case f.members != nil:
+		return f.members
+	case f.v.maps != nil:
+		return append([]projection{f.projection}, f.maps()...)
+	}
+	return []projection{f.projection}
+}
+
+// writeXDR writes the data of p in XDR.  Arrays start with their length, twice, except
+// for arrays of strings.  Bytes are packed and padded to a multiple of 4, other types
+// smaller than 4 bytes are sent as 4 bytes.  Scalars are sent without length.
+func (d *Dataset) writeXDR(w *bufio.Writer, p projection) error {
+	n := p.size()
+	scalar := len(p.v.dims) == 0
+	var b [8]byte
+	put32 := func(x uint32) {
+		b[0], b[1], b[2], b[3] = byte(x>>24), byte(x>>16), byte(x>>8), byte(x)
+		w.Write(b[:4])
+	}
+	if !scalar {
+		put32(uint32(n))
+		if p.v.typ != "String" {
+			put32(uint32(n))
+		}
+	}
+	err := d.read(p, func(values interface{}) {
+		switch values := values.(type) {
+		case []int8:
+			for _, x := range values {
+				put32(uint32(int32(x)))
+			}
+		case []uint8:
+			if scalar {
+				put32(uint32(values[0]))
+			} else {
+				w.Write(values)
+			}
+		case []int16:
+			for _, x := range values {
+				put32(uint32(int32(x)))
+			}
+		case []uint16:
+			for _, x := range values {
+				put32(uint32(x))
+			}
+		case []int32:
+			for _, x := range values {
+				put32(uint32(x))
+			}
+		case []uint32:
+			for _, x := range values {
+				put32(x)
+			}
+		case []float32:
+			for _, x := range values {
+				put32(math.Float32bits(x))
+			}
+		case []float64:
+			for _, x := range values {
+				u := math.Float64bits(x)
+				put32(uint32(u >> 32))
+				put32(uint32(u))
+			}
+		case []string:
+			for _, s := range values {
+				put32(uint32(len(s)))
+				w.WriteString(s)
+				w.Write(make([]byte, pad(len(s))))
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if p.v.typ == "Byte" && !scalar {
+		w.Write(make([]byte, pad(n)))
+	}
+	return nil
+}
+
+// pad returns the number of bytes to pad n bytes to a multiple of 4.
+func pad(n int) int { return (4 - n%4) % 4 }
+
+// WriteASCII writes the data of the variables of d projected by the constraint expression ce to w
+// as text: a line with the name of the dataset, and for every variable lines of comma separated values
+// along the innermost dimension, starting with the name and the indices of the other dimensions.
+// Errors in ce are returned as an *Error before anything is written.
+func (d *Dataset) WriteASCII(w io.Writer, ce string) error {
+	fields, err := parseConstraint(d.variables(), ce)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Dataset: %s\n", d.Name)
+	for _, f := range fields {
+		prefix := ""
+		if f.members != nil || f.v.maps != nil {
+			prefix = f.v.name + "."
+		}
+		for _, p := range f.parts() {
+			if err := d.writeASCII(bw, prefix+p.v.name, p); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func (d *Dataset) writeASCII(w *bufio.Writer, name string, p projection) error {
+	row := 1
+	if len(p.count) > 0 {
+		row = p.count[len(p.count)-1]
+	}
+	if p.size() == 0 {
+		return nil
+	}
+	idx := make([]int, len(p.count))
+	k := 0 // in the row
+	return d.read(p, func(values interface{}) {
+		rv := reflect.ValueOf(values)
+		for i := 0; i < rv.Len(); i++ {
+			if k == 0 {
+				w.WriteString(name)
+				if len(idx) > 1 {
+					for _, j := range idx[:len(idx)-1] {
+						fmt.Fprintf(w, "[%d]", j)
+					}
+				}
+			}
+			w.WriteString(", ")
+			if s, ok := values.([]string); ok {
+				w.WriteString(quote(s[i]))
+			} else {
+				w.WriteString(formatValue(rv.Index(i).Interface()))
+			}
+			if k++; k == row {
+				w.WriteByte('\n')
+				k = 0
+				// advance the outer indices
+				for j := len(idx) - 2; j >= 0; j-- {
+					if idx[j]++; idx[j] < p.count[j] {
+						break
+					}
+					idx[j] = 0
+				}
+			}
+		}
+	})
+}
+
+// read reads the data of p in chunks, and calls fn with each as a slice of the type of the variable,
+// or a []string for CHAR variables, without trailing NULs.
+func (d *Dataset) read(p projection, fn func(values interface{})) error {
+	n := p.size()
+	if n == 0 {
+		return nil
+	}
+	start, count, stride := p.start, p.count, p.stride
+	if p.v.strlen > 0 && len(d.File.Header.Dimensions(p.v.name)) > 0 {
+		start = append(append([]int(nil), start...), 0)
+		count = append(append([]int(nil), count...), p.v.strlen)
+		stride = append(append([]int(nil), stride...), 1)
+	}
+	r, err := d.File.StridedReader(p.v.name, start, count, stride)
+	if err != nil {
+		return err
+	}
+
+	const chunk = 1 << 14
+	m := chunk
+	if n < m {
+		m = n
+	}
+	var buf reflect.Value
+	if p.v.strlen > 0 {
+		buf = reflect.ValueOf(make([]int8, m*p.v.strlen))
+	} else {
+		buf = reflect.ValueOf(d.File.Header.ZeroValue(p.v.name, m))
+	}
+	for n > 0 {
+		if n < m {
+			m = n
+		}
+		l := m
+		if p.v.strlen > 0 {
+			l *= p.v.strlen
+		}
+		values := buf.Slice(0, l).Interface()
+		if k, err := r.Read(values); k < l {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if p.v.strlen > 0 {
+			values = toStrings(values.([]int8), p.v.strlen)
+		}
+		fn(values)
+		n -= m
+	}
+	return nil
+}
+
+// toStrings returns the strings of length strlen in c, without trailing NULs.
+func toStrings(c []int8, strlen int) []string {
+	s := make([]string, len(c)/strlen)
+	b := make([]byte, strlen)
+	for i := range s {
+		for j, x := range c[i*strlen : (i+1)*strlen] {
+			b[j] = byte(x)
+		}
+		s[i] = strings.TrimRight(string(b), "\x00")
+	}
+	return s
+}
+
+// formatValue formats a number as in a DAS or an ASCII response.
+func formatValue(x interface{}) string {
+	switch x := x.(type) {
+	case float32:
+		return formatFloat(float64(x), 32)
+	case float64:
+		return formatFloat(x, 64)
+	case int64:
+		return formatFloat(float64(x), 64)
+	case uint64:
+		return formatFloat(float64(x), 64)
+	}
+	return fmt.Sprint(x)
+}
+
+func formatFloat(x float64, bits int) string {
+	switch {
+	case math.IsNaN(x):
+		return "NaN"
+	case math.IsInf(x, 1):
+		return "Inf"
+	case math.IsInf(x, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(x, 'g', -1, bits)
+}
+
+// quote returns s in double quotes, with backslashes and double quotes escaped.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,280 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+// createTestFile creates dir/sub/test.nc.
+func createTestFile(t *testing.T, dir string) {
+	h := cdf.NewHeader([]string{"time", "lat", "strlen"}, []int{0, 2, 3})
+	h.AddAttribute("", "title", "a \"test\"")
+	h.AddVariable("time", []string{"time"}, []float64{})
+	h.AddAttribute("time", "units", "hours since 2000-01-01")
+	h.AddVariable("lat", []string{"lat"}, []float32{})
+	h.AddVariable("t", []string{"time", "lat"}, []int16{})
+	h.AddAttribute("t", "scale_factor", []float32{0.5})
+	h.AddAttribute("t", "valid_range", []int16{0, 100})
+	h.AddVariable("name", []string{"lat", "strlen"}, "")
+	h.AddVariable("b", []string{"lat"}, []int8{})
+	h.AddVariable("u", []string{"lat"}, []uint8{})
+	h.AddVariable("n", []string{"lat"}, []int64{})
+	h.AddVariable("s", nil, []int32{})
+	if err := h.DefineVersion(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	ff, err := os.Create(filepath.Join(dir, "sub", "test.nc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	f, err := cdf.Create(ff, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v, x := range map[string]interface{}{
+		"lat":  []float32{10.5, -20},
+		"name": []int8{'a', 'b', 0, 'c', '"', 'd'},
+		"b":    []int8{-1, 2},
+		"u":    []uint8{255, 2},
+		"n":    []int64{1, 2},
+		"s":    []int32{42},
+	} {
+		w, err := f.Writer(v, nil, nil)
+		if err != nil {
+			t.Fatal(v, err)
+		}
+		if _, err := w.Write(x); err != nil && err != io.EOF {
+			t.Fatal(v, err)
+		}
+	}
+	a, err := f.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []map[string]interface{}{
+		{"time": []float64{0}, "t": []int16{1, 2}},
+		{"time": []float64{6}, "t": []int16{3, 4}},
+		{"time": []float64{12}, "t": []int16{5, 6}},
+	} {
+		if _, err := a.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func get(t *testing.T, url string) (int, http.Header, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header, string(b)
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	createTestFile(t, dir)
+	srv := httptest.NewServer(Handler(dir))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path, exp string
+	}{
+		{"/sub/test.nc.das", `Attributes {
+    NC_GLOBAL {
+        String title "a \"test\"";
+    }
+    time {
+        String units "hours since 2000-01-01";
+    }
+    lat {
+    }
+    t {
+        Float32 scale_factor 0.5;
+        Int16 valid_range 0, 100;
+    }
+    name {
+    }
+    b {
+    }
+    u {
+    }
+    s {
+    }
+}
+`},
+		{"/sub/test.nc.dds", `Dataset {
+    Float64 time[time = 3];
+    Float32 lat[lat = 2];
+    Grid {
+      ARRAY:
+        Int16 t[time = 3][lat = 2];
+      MAPS:
+        Float64 time[time = 3];
+        Float32 lat[lat = 2];
+    } t;
+    String name[lat = 2];
+    Grid {
+      ARRAY:
+        Int16 b[lat = 2];
+      MAPS:
+        Float32 lat[lat = 2];
+    } b;
+    Grid {
+      ARRAY:
+        Byte u[lat = 2];
+      MAPS:
+        Float32 lat[lat = 2];
+    } u;
+    Int32 s;
+} test.nc;
+`},
+		{"/sub/test.nc.dds?t%5B0:2:2%5D%5B1%5D,t.time%5B1:2%5D,name,t.lat", `Dataset {
+    Grid {
+      ARRAY:
+        Int16 t[time = 2][lat = 1];
+      MAPS:
+        Float64 time[time = 2];
+        Float32 lat[lat = 1];
+    } t;
+    Structure {
+        Float64 time[time = 2];
+        Float32 lat[lat = 2];
+    } t;
+    String name[lat = 2];
+} test.nc;
+`},
+		{"/sub/test.nc.asc?t[1:2][0:1],name,s,t.lat", `Dataset: test.nc
+t.t[0], 3, 4
+t.t[1], 5, 6
+t.time, 6, 12
+t.lat, 10.5, -20
+name, "ab", "c\"d"
+s, 42
+t.lat, 10.5, -20
+`},
+	} {
+		code, hdr, body := get(t, srv.URL+tc.path)
+		if code != http.StatusOK || hdr.Get("XDAP") != "2.0" {
+			t.Errorf("%s: status %d, header %v", tc.path, code, hdr)
+		}
+		if body != tc.exp {
+			t.Errorf("%s: got\n%s\nexpected\n%s", tc.path, body, tc.exp)
+		}
+	}
+
+	code, hdr, body := get(t, srv.URL+"/sub/test.nc.dods?lat,b,u,s,name[1],t.time[2]")
+	if code != http.StatusOK || hdr.Get("Content-Description") != "dods-data" {
+		t.Errorf("dods: status %d, header %v", code, hdr)
+	}
+	dds, data, _ := strings.Cut(body, "\nData:\n")
+	if !strings.HasPrefix(dds, "Dataset {\n    Float32 lat[lat = 2];\n") || !strings.HasSuffix(dds, "} test.nc;\n") {
+		t.Errorf("dods: dds %q", dds)
+	}
+	exp := []byte{
+		0, 0, 0, 2, 0, 0, 0, 2, 0x41, 0x28, 0, 0, 0xc1, 0xa0, 0, 0, // lat
+		0, 0, 0, 2, 0, 0, 0, 2, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 2, // b
+		0, 0, 0, 2, 0, 0, 0, 2, 0x41, 0x28, 0, 0, 0xc1, 0xa0, 0, 0, // lat map of b
+		0, 0, 0, 2, 0, 0, 0, 2, 255, 2, 0, 0, // u
+		0, 0, 0, 2, 0, 0, 0, 2, 0x41, 0x28, 0, 0, 0xc1, 0xa0, 0, 0, // lat map of u
+		0, 0, 0, 42, // s
+		0, 0, 0, 1, 0, 0, 0, 3, 'c', '"', 'd', 0, // name[1]
+		0, 0, 0, 1, 0, 0, 0, 1, 0x40, 0x28, 0, 0, 0, 0, 0, 0, // t.time[2]
+	}
+	if !bytes.Equal([]byte(data), exp) {
+		t.Errorf("dods: data\n%v\nexpected\n%v", []byte(data), exp)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/sub/test.nc.dds?nope", http.StatusBadRequest, "1004"},
+		{"/sub/test.nc.dds?t.nope", http.StatusBadRequest, "1004"},
+		{"/sub/test.nc.dds?lat.lat", http.StatusBadRequest, "1004"},
+		{"/sub/test.nc.dods?t[0:3][0]", http.StatusBadRequest, "1005"},
+		{"/sub/test.nc.dods?t[0]", http.StatusBadRequest, "1005"},
+		{"/sub/test.nc.asc?t[2:1][0]", http.StatusBadRequest, "1005"},
+		{"/sub/test.nc.asc?t[0:0:1][0]", http.StatusBadRequest, "1005"},
+		{"/sub/test.nc.dds?lat&lat>0", http.StatusBadRequest, "1005"},
+		{"/sub/missing.nc.dds", http.StatusNotFound, "1003"},
+		{"/sub/test.nc.html", http.StatusNotFound, "1003"},
+		{"/../dap_test.go.dds", http.StatusNotFound, "1003"},
+	} {
+		code, hdr, body := get(t, srv.URL+tc.path)
+		if code != tc.status || hdr.Get("Content-Description") != "dods-error" || !strings.Contains(body, "code = "+tc.code+";") {
+			t.Errorf("%s: status %d, %q", tc.path, code, body)
+		}
+	}
+}
+
+func TestDatasetKeepsHeader(t *testing.T) {
+	dir := t.TempDir()
+	createTestFile(t, dir)
+	ff, err := os.Open(filepath.Join(dir, "sub", "test.nc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	f, err := cdf.Open(ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDataset("test.nc", f)
+	var a, b bytes.Buffer
+	if err := d.WriteDDS(&a, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteDDS(&b, ""); err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != b.String() {
+		t.Errorf("second DDS\n%s\ndiffers from the first\n%s", &b, &a)
+	}
+	if !f.Header.IsRecordVariable("t") || f.Header.Lengths("t")[0] != 0 {
+		t.Error("header changed:", f.Header.Lengths("t"))
+	}
+
+	r, err := f.Reader("t", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := make([]int16, 6)
+	if n, _ := r.Read(x); n != 6 || fmt.Sprint(x) != "[1 2 3 4 5 6]" {
+		t.Error("reading t after WriteDDS:", n, x)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the HTTP handler and the DAP2 errors.
+
+package dap
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+// The error codes of DAP2.
+const (
+	UndefinedError = 1000 + iota
+	UnknownError
+	InternalError
+	NoSuchFile
+	NoSuchVariable
+	MalformedExpr
+	NoAuthorization
+	CannotReadFile
+)
+
+// An Error is a DAP2 error, sent to the client in the body of the response.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// WriteTo writes e as a DAP2 error response body.
+func (e *Error) WriteTo(w io.Writer) (int64, error) {
+	n, err := fmt.Fprintf(w, "Error {\n    code = %d;\n    message = %s;\n};\n", e.Code, quote(e.Message))
+	return int64(n), err
+}
+
+// status returns the HTTP status for the error code.
+func (e *Error) status() int {
+	switch e.Code {
+	case NoSuchFile:
+		return http.StatusNotFound
+	case NoSuchVariable, MalformedExpr:
+		return http.StatusBadRequest
+	case NoAuthorization:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// Handler returns an http.Handler that serves the NetCDF files in the directory tree root as
+// DAP2 datasets.  The responses for the file root/dir/file.nc are at /dir/file.nc.das, .dds, .dods
+// and .asc, with the constraint expression in the query.  The file is opened for every request.
+// If the number of records in the file does not match the header, the complete records are served.
+func Handler(root string) http.Handler { return handler(root) }
+
+type handler string
+
+var descriptions = map[string]string{
+	".das":  "dods-das",
+	".dds":  "dods-dds",
+	".dods": "dods-data",
+	".asc":  "dods-ascii",
+}
+
+func (root handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p := path.Clean("/" + req.URL.Path)
+	ext := path.Ext(p)
+	desc, ok := descriptions[ext]
+	if !ok {
+		writeError(w, &Error{NoSuchFile, "unknown response type " + ext})
+		return
+	}
+	name := strings.TrimSuffix(p, ext)
+
+	ff, err := os.Open(filepath.Join(string(root), filepath.FromSlash(name)))
+	if err != nil {
+		writeError(w, &Error{NoSuchFile, "no such file: " + name})
+		return
+	}
+	defer ff.Close()
+	f, err := cdf.Open(ff)
+	numrecs := int64(0)
+	switch e := err.(type) {
+	case nil:
+		numrecs = f.NumRecs()
+	case *cdf.NumRecsError:
+		numrecs = e.Complete
+		if e.NumRecs < e.Complete {
+			numrecs = e.NumRecs
+		}
+	default:
+		writeError(w, &Error{CannotReadFile, name + ": " + err.Error()})
+		return
+	}
+	d := &Dataset{Name: path.Base(name), File: f, NumRecs: numrecs}
+
+	w.Header().Set("XDODS-Server", "dods/2.0")
+	w.Header().Set("XDAP", "2.0")
+	w.Header().Set("Content-Description", desc)
+	if ext == ".dods" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	// constraint errors are returned before anything is written; later errors
+	// can only end the response.
+	switch ext {
+	case ".das":
+		err = d.WriteDAS(w)
+	case ".dds":
+		err = d.WriteDDS(w, req.URL.RawQuery)
+	case ".dods":
+		err = d.WriteDODS(w, req.URL.RawQuery)
+	case ".asc":
+		err = d.WriteASCII(w, req.URL.RawQuery)
+	}
+	if e, ok := err.(*Error); ok {
+		writeError(w, e)
+	} else if err != nil {
+		log.Print(name, ": ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, e *Error) {
+	w.Header().Set("XDODS-Server", "dods/2.0")
+	w.Header().Set("XDAP", "2.0")
+	w.Header().Set("Content-Description", "dods-error")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(e.status())
+	e.WriteTo(w)
+}
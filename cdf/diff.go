@@ -0,0 +1,293 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the comparison of two files.
+
+package cdf
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// A Tolerance decides which pairs of values are different: a and b differ if
+// |a-b| > Abs and |a-b| > Rel * max(|a|, |b|), so the zero Tolerance requires equality.
+type Tolerance struct {
+	Abs, Rel float64
+}
+
+func (t Tolerance) differ(a, b float64) bool {
+	d := math.Abs(a - b)
+	return d > t.Abs && d > t.Rel*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// A FileDiff lists the differences between two files found by Diff.
+type FileDiff struct {
+	Header []string  // the differences between the headers, one per line
+	Vars   []VarDiff // the variables with differing data
+}
+
+// Equal reports whether no differences were found.
+func (d *FileDiff) Equal() bool { return len(d.Header) == 0 && len(d.Vars) == 0 }
+
+// A VarDiff summarizes the differences between the data of a variable in two files.
+// Values are compared after unpacking.  Missing values, as defined by the variable's Mask,
+// are equal to each other and differ from all present values.  The statistics are over the pairs of
+// present values.
+type VarDiff struct {
+	Var      string
+	Compared int64      // the number of pairs of values compared
+	Count    int64      // the number of pairs that differ
+	First    []ElemDiff // the first differences, at most as many as requested from Diff
+	MaxAbs   float64    // the maximum absolute difference
+	MaxRel   float64    // the maximum difference relative to max(|a|, |b|)
+	RMS      float64    // the root mean square difference
+}
+
+// An ElemDiff is a pair of differing values, NaN if missing, and their index.
+type ElemDiff struct {
+	Index []int
+	A, B  float64
+}
+
+// Diff compares the headers and data of a and b, which have anr and bnr records.  These are
+// normally a.NumRecs() and b.NumRecs(), or the number of complete records of a truncated file
+// as reported by a NumRecsError.  Diff compares the data of the variables that have the same
+// dimensions in both, for the records they have in common, and reports at most n differing
+// elements per variable.  Diff only returns an error if the data can not be read.
+func Diff(a, b *File, anr, bnr int64, tol Tolerance, n int) (*FileDiff, error) {
+	d := &FileDiff{Header: diffHeaders(a.Header, b.Header)}
+
+	if anr != bnr {
+		d.Header = append(d.Header, fmt.Sprintf("numrecs: %d vs %d", anr, bnr))
+	}
+	nr := anr
+	if bnr < nr {
+		nr = bnr
+	}
+
+	for i := range a.Header.vars {
+		av := &a.Header.vars[i]
+		bv := b.Header.varByName(av.name)
+		if bv == nil || !reflect.DeepEqual(a.Header.Dimensions(av.name), b.Header.Dimensions(av.name)) ||
+			!reflect.DeepEqual(av.lengths, bv.lengths) {
+			continue
+		}
+		if av.isRecordVariable() && nr <= 0 {
+			continue
+		}
+		vd, err := diffData(a, b, av, tol, n, int(nr))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", av.name, err)
+		}
+		if vd.Count > 0 {
+			d.Vars = append(d.Vars, *vd)
+		}
+	}
+	return d, nil
+}
+
+func diffHeaders(a, b *Header) (r []string) {
+	if a.version != b.version {
+		r = append(r, fmt.Sprintf("version: %v vs %v", a.version, b.version))
+	}
+	for i := range a.dim {
+		if j := b.dimByName(a.dim[i].name); j < 0 {
+			r = append(r, fmt.Sprintf("dimension %s: only in first", a.dim[i].name))
+		} else if a.dim[i].length != b.dim[j].length {
+			r = append(r, fmt.Sprintf("dimension %s: length %d vs %d", a.dim[i].name, a.dim[i].length, b.dim[j].length))
+		}
+	}
+	for i := range b.dim {
+		if a.dimByName(b.dim[i].name) < 0 {
+			r = append(r, fmt.Sprintf("dimension %s: only in second", b.dim[i].name))
+		}
+	}
+
+	r = append(r, diffAttributes("", a.att, b.att)...)
+
+	for i := range a.vars {
+		av := &a.vars[i]
+		bv := b.varByName(av.name)
+		if bv == nil {
+			r = append(r, fmt.Sprintf("variable %s: only in first", av.name))
+			continue
+		}
+		if av.dtype != bv.dtype {
+			r = append(r, fmt.Sprintf("variable %s: type %v vs %v", av.name, av.dtype, bv.dtype))
+		}
+		if ad, bd := a.Dimensions(av.name), b.Dimensions(av.name); !reflect.DeepEqual(ad, bd) {
+			r = append(r, fmt.Sprintf("variable %s: dimensions %v vs %v", av.name, ad, bd))
+		}
+		r = append(r, diffAttributes(av.name, av.att, bv.att)...)
+	}
+	for i := range b.vars {
+		if a.varByName(b.vars[i].name) == nil {
+			r = append(r, fmt.Sprintf("variable %s: only in second", b.vars[i].name))
+		}
+	}
+	return r
+}
+
+func diffAttributes(v string, a, b []attribute) (r []string) {
+	find := func(att []attribute, name string) *attribute {
+		for i := range att {
+			if att[i].name == name {
+				return &att[i]
+			}
+		}
+		return nil
+	}
+	for i := range a {
+		aa := &a[i]
+		ba := find(b, aa.name)
+		switch {
+		case ba == nil:
+			r = append(r, fmt.Sprintf("attribute %s:%s: only in first", v, aa.name))
+		case aa.dtype != ba.dtype:
+			r = append(r, fmt.Sprintf("attribute %s:%s: type %v vs %v", v, aa.name, aa.dtype, ba.dtype))
+		case !reflect.DeepEqual(aa.values, ba.values):
+			r = append(r, fmt.Sprintf("attribute %s:%s: %v vs %v", v, aa.name, aa.values, ba.values))
+		}
+	}
+	for i := range b {
+		if find(a, b[i].name) == nil {
+			r = append(r, fmt.Sprintf("attribute %s:%s: only in second", v, b[i].name))
+		}
+	}
+	return r
+}
+
+// A valueReader reads values and whether they are present, like MaskedReader.
+type valueReader interface {
+	Read(values []float64, valid []bool) (int, error)
+}
+
+// A charReader reads CHAR data as values that are all present.
+type charReader struct {
+	r   Reader
+	buf []int8
+}
+
+func (r *charReader) Read(values []float64, valid []bool) (n int, err error) {
+	if len(r.buf) < len(values) {
+		r.buf = make([]int8, len(values))
+	}
+	n, err = r.r.Read(r.buf[:len(values)])
+	for i, c := range r.buf[:n] {
+		values[i], valid[i] = float64(c), true
+	}
+	return n, err
+}
+
+func (f *File) valueReader(vv *variable, end []int) (valueReader, error) {
+	if vv.dtype == _CHAR {
+		r, err := f.Reader(vv.name, nil, end)
+		if err != nil {
+			return nil, err
+		}
+		return &charReader{r: r}, nil
+	}
+	return f.MaskedReader(vv.name, nil, end)
+}
+
+// diffData compares the data of variable vv of a and b, up to record nr if it is a record variable.
+func diffData(a, b *File, vv *variable, tol Tolerance, n, nr int) (*VarDiff, error) {
+	lengths := append([]int(nil), vv.lengths...)
+	if vv.isRecordVariable() {
+		lengths[0] = nr
+	}
+	end := make([]int, len(lengths))
+	total := int64(1)
+	for i, l := range lengths {
+		end[i] = l - 1
+		total *= int64(l)
+	}
+	d := &VarDiff{Var: vv.name}
+	if total == 0 {
+		return d, nil
+	}
+
+	ar, err := a.valueReader(vv, end)
+	if err != nil {
+		return nil, err
+	}
+	br, err := b.valueReader(b.Header.varByName(vv.name), end)
+	if err != nil {
+		return nil, err
+	}
+
+	const chunk = 1 << 14
+	av, bv := make([]float64, chunk), make([]float64, chunk)
+	aok, bok := make([]bool, chunk), make([]bool, chunk)
+	var sum float64
+	for pos := int64(0); pos < total; pos += chunk {
+		m := chunk
+		if total-pos < chunk {
+			m = int(total - pos)
+		}
+		if k, err := ar.Read(av[:m], aok[:m]); k < m {
+			return nil, noEOF(err)
+		}
+		if k, err := br.Read(bv[:m], bok[:m]); k < m {
+			return nil, noEOF(err)
+		}
+		for i := 0; i < m; i++ {
+			x, y := av[i], bv[i]
+			if aok[i] && bok[i] {
+				d.Compared++
+				dx := math.Abs(x - y)
+				sum += dx * dx
+				if dx > d.MaxAbs {
+					d.MaxAbs = dx
+				}
+				if s := math.Max(math.Abs(x), math.Abs(y)); s > 0 && dx/s > d.MaxRel {
+					d.MaxRel = dx / s
+				}
+				if !tol.differ(x, y) {
+					continue
+				}
+			} else if aok[i] == bok[i] {
+				continue
+			}
+			d.Count++
+			if len(d.First) < n {
+				d.First = append(d.First, ElemDiff{Index: unravel(pos+int64(i), lengths), A: x, B: y})
+			}
+		}
+	}
+	if d.Compared > 0 {
+		d.RMS = math.Sqrt(sum / float64(d.Compared))
+	}
+	return d, nil
+}
+
+func noEOF(err error) error {
+	if err == nil || err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// unravel returns the index of the i'th element in row-major order of an array with the given lengths.
+func unravel(i int64, lengths []int) []int {
+	idx := make([]int, len(lengths))
+	for j := len(lengths) - 1; j >= 0; j-- {
+		idx[j] = int(i % int64(lengths[j]))
+		i /= int64(lengths[j])
+	}
+	return idx
+}
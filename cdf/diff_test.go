@@ -0,0 +1,97 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	newFile := func(extra bool, x []float32, c string) (*File, func()) {
+		h := NewHeader([]string{"time", "x"}, []int{0, 3})
+		h.AddVariable("x", []string{"x"}, []float32{})
+		h.AddVariable("r", []string{"time", "x"}, []int16{})
+		h.AddAttribute("r", "_FillValue", []int16{-1})
+		h.AddVariable("c", []string{"x"}, "")
+		if extra {
+			h.AddAttribute("", "history", "changed")
+			h.AddAttribute("x", "units", "m")
+		}
+		h.Define()
+		f, cleanup := createTestFile(t, h)
+		if n, _ := mustWriter(t, f, "x", nil, nil).Write(x); n != 3 {
+			t.Fatal("writing x")
+		}
+		if n, _ := mustWriter(t, f, "c", nil, nil).Write(c); n != 3 {
+			t.Fatal("writing c")
+		}
+		return f, cleanup
+	}
+
+	a, cleanup := newFile(false, []float32{1, 2, 3}, "abc")
+	defer cleanup()
+	b, cleanup := newFile(true, []float32{1, 2.001, 4}, "abd")
+	defer cleanup()
+
+	aa, _ := a.Appender()
+	ba, _ := b.Appender()
+	for _, r := range [][2][]int16{{{1, -1, 3}, {1, -1, 3}}, {{-1, 5, 6}, {-1, 5, 7}}, {{0, 0, 0}, {1, 1, 1}}} {
+		aa.Append(map[string]interface{}{"r": r[0]})
+		ba.Append(map[string]interface{}{"r": r[1]})
+	}
+	ba.Append(map[string]interface{}{"r": []int16{9, 9, 9}})
+
+	d, err := Diff(a, a, 3, 3, Tolerance{}, 10)
+	if err != nil || !d.Equal() {
+		t.Error("a differs from itself:", d, err)
+	}
+
+	d, err = Diff(a, b, 3, 4, Tolerance{Abs: .01}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"attribute :history: only in second",
+		"attribute x:units: only in second",
+		"numrecs: 3 vs 4",
+	}
+	if !reflect.DeepEqual(d.Header, exp) {
+		t.Errorf("header differences: got %q, expected %q", d.Header, exp)
+	}
+	if len(d.Vars) != 3 {
+		t.Fatal("variable differences:", d.Vars)
+	}
+	if v := d.Vars[0]; v.Var != "x" || v.Count != 1 || v.Compared != 3 || v.MaxAbs != 1 || v.MaxRel != .25 ||
+		!reflect.DeepEqual(v.First, []ElemDiff{{[]int{2}, 3, 4}}) {
+		t.Errorf("x: %+v", v)
+	}
+	if v := d.Vars[1]; v.Var != "r" || v.Count != 4 || v.Compared != 7 || len(v.First) != 2 ||
+		!reflect.DeepEqual(v.First[0], ElemDiff{[]int{1, 2}, 6, 7}) || !reflect.DeepEqual(v.First[1].Index, []int{2, 0}) {
+		t.Errorf("r: %+v", v)
+	}
+	if v := d.Vars[2]; v.Var != "c" || v.Count != 1 || v.First[0].A != 'c' || v.First[0].B != 'd' {
+		t.Errorf("c: %+v", v)
+	}
+
+	if d, _ := Diff(a, b, 3, 4, Tolerance{Rel: .5}, 0); len(d.Vars) != 1 || d.Vars[0].Count != 3 || len(d.Vars[0].First) != 0 {
+		t.Errorf("with relative tolerance: %+v", d.Vars)
+	}
+
+	// only the first record, as for truncated files.
+	if d, _ := Diff(a, b, 1, 1, Tolerance{Rel: .5}, 0); len(d.Header) != 2 || len(d.Vars) != 0 {
+		t.Errorf("first record: %q %+v", d.Header, d.Vars)
+	}
+}
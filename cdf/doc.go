@@ -12,16 +12,21 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package CDF provides facilities to read and write files in NetCDF 'classic' (V1 or V2) format.
+// Package CDF provides facilities to read and write files in NetCDF 'classic' (V1 or V2) format,
+// and in the CDF-5 (V5) format with 64 bit data types introduced by PnetCDF.
 // The HDF based NetCDF-4 format is not supported.
 //
 // The data model and the classic file format are documented at
 //	http://www.unidata.ucar.edu/software/netcdf/docs/tutorial.html
 // 	http://www.unidata.ucar.edu/software/netcdf/docs/classic_format_spec.html
+// and the CDF-5 extensions at
+//	http://cucis.ece.northwestern.edu/projects/PnetCDF/CDF-5.html
 //
-// A NetCDF file contains an immutable header (this library does not support modifying it)
-// that defines the layout of the data section and contains metadata.  The data can be read,
-// written and, if there exists a record dimension, appended to.
+// A NetCDF file contains a header that defines the layout of the data section and contains
+// metadata.  The data can be read, written and, if there exists a record dimension, appended to.
+// The header itself is immutable, but variables and attributes can be added to an existing
+// file by obtaining a mutable copy with f.Redef and passing it to f.EndDef, which moves
+// the data if needed.
 //
 // To create a new file, first create a header, e.g.:
 //
@@ -41,13 +46,57 @@
 //
 //
 // The Header field of f is now usable for inspection of dimensions, variables and attributes, but
-// should not be modified (obvious ways of doing this will cause panics).
+// should not be modified (obvious ways of doing this will cause panics).  The number of records
+// is given by f.NumRecs, and readers of record variables stop after the last record.
 //
 // To read data from the file, use 
-//	r := f.Reader("psi", nil, nil)
+//	r, err := f.Reader("psi", nil, nil)     // err is ErrUnknownVariable if there is no psi.
 //	buf := r.Zero(100)      // a []T of the right T for the variable.
 //	n, err := r.Read(buf)   // similar to io.Read, but reads T's instead of bytes.
 //
-// And similar for writing.
+// And similar for writing.  To add records to a file and keep its numrecs header field up to date, use
+//	a, _ := f.Appender()
+//	a.Append(map[string]interface{}{"psi": psi})  // psi is a []float32 of length 10
+//
+// If the element type is known at compile time, the generic accessors check it once instead:
+//	r, err := cdf.NewTypedReader[float32](f, "psi", nil, nil)  // err if psi is not a FLOAT
+//	psi, err := cdf.ReadVar[float32](f, "psi", nil, nil)       // all of psi as a []float32
+//
+// Packed data, stored with the scale_factor and add_offset attributes of the CF conventions,
+// can be read as floating point values with f.UnpackingReader and written with f.PackingWriter.
+// A f.MaskedReader additionally replaces missing values, as defined by the _FillValue, missing_value
+// and valid_range attributes and summarized by f.Header.Mask, with NaN.
+// Time coordinates with CF units like "hours since 1970-01-01" and any of the CF calendars
+// can be read and written as time.Time values with f.ReadTimes and f.WriteTimes.
+//
+// Instead of by index, the data can also be selected by the values of the coordinate variables:
+//	r, start, count, err := f.Select("psi", cdf.Range{Dim: "x", Lo: 2.5, Hi: 7.5})
+//
+// Files with the same variables, like one file per day of a model run, can be read as one
+// with cdf.Aggregate, whose records are the records of all files:
+//	all, err := cdf.Aggregate(f1, f2, f3)
+//
+// cdf.Diff compares the headers and the data of two files, with a tolerance for numeric differences.
+//
+// f.Stats and f.StatsAlong compute the minimum, maximum, mean and standard deviation of a variable,
+// in total or for every index of one of its dimensions, excluding the missing values.
+//
+// Variables can be exported to the NumPy .npy format with f.WriteNpy, and arrays in that format
+// imported with a NpyReader.
+//
+// f.WriteTable writes a variable in long form, one row per element with the values of the
+// coordinate variables, as CSV, TSV or newline delimited JSON.
+//
+// An HTTPReaderAt is a read-only ReaderWriterAt for a file on an HTTP server that supports
+// Range requests, with a cache of blocks of the file, so Open can read remote files without downloading them.
+//
+// On Linux, OpenMmap opens a file mapped into memory, and its Readers decode the data straight
+// from the mapping.
+//
+// A Cache keeps blocks of any ReaderWriterAt in memory, reading ahead of sequential reads and
+// writing modified blocks back on eviction or Flush, so that the small reads and writes of
+// record variables become fewer, larger ones.
+//
+// Package code.google.com/p/lvd.go/cdf/dap serves files over the DAP2 (OPeNDAP) protocol.
 //
 package cdf
@@ -19,9 +19,20 @@ package cdf
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 )
 
+var (
+	ErrUnknownVariable = errors.New("no such variable")
+	ErrBadIndex        = errors.New("invalid index vector")
+	ErrHeaderMutable   = errors.New("header is mutable")
+	ErrHeaderImmutable = errors.New("header is immutable")
+
+	errRecordVariable = errors.New("is a record variable")
+	errBadFillValue   = errors.New("invalid fill value")
+)
+
 // A ReaderWriterAt is the underlying storage for a NetCDF file,
 // providing {Read,Write}At([]byte, int64) methods.
 // Since {Read,Write}At are required to not modify the underlying
@@ -34,29 +45,43 @@ type ReaderWriterAt interface {
 }
 
 type File struct {
-	rw     ReaderWriterAt
-	Header *Header
+	rw      ReaderWriterAt
+	Header  *Header
+	numrecs int64 // committed number of records or -1 for STREAMING, accessed atomically.
 }
 
 // Open reads the header from an existing storage rw and returns a File
 // usable for reading or writing (if the underlying rw permits).
+//
+// Open also reads the numrecs field of the header.  If rw has a Stat or Size method,
+// the number of records is checked against the size of the storage, and if the
+// storage is truncated or has a trailing partial record, Open returns the File
+// together with a *NumRecsError.
 func Open(rw ReaderWriterAt) (*File, error) {
 	h, err := ReadHeader(io.NewSectionReader(rw, 0, 1<<31))
 	if err != nil {
 		return nil, err
 	}
-	return &File{rw: rw, Header: h}, nil
+	nr, err := readNumRecs(rw)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{rw: rw, Header: h, numrecs: nr}
+	if err := f.checkNumRecs(); err != nil {
+		return f, err
+	}
+	return f, nil
 }
 
 // Create writes the header to a storage rw and returns a File
 // usable for reading and writing.
 //
-// The header should not be mutable, and may be shared by multiple
+// The header should not be mutable, or ErrHeaderMutable is returned, and may be shared by multiple
 // Files.  Note that at every Create the headers numrec
 // field will be reset to -1 (STREAMING).
 func Create(rw ReaderWriterAt, h *Header) (*File, error) {
 	if h.isMutable() {
-		panic("Create must be called with a fully defined header")
+		return nil, ErrHeaderMutable
 	}
 	var buf bytes.Buffer
 	err := h.WriteHeader(&buf)
@@ -66,14 +91,14 @@ func Create(rw ReaderWriterAt, h *Header) (*File, error) {
 	if _, err := rw.WriteAt(buf.Bytes(), 0); err != nil {
 		return nil, err
 	}
-	return &File{rw: rw, Header: h}, nil
+	return &File{rw: rw, Header: h, numrecs: int64(_STREAMING)}, nil
 }
 
 func fill(w io.WriterAt, begin, end int64, val interface{}, dtype datatype) error {
 	var buf bytes.Buffer
 	binary.Write(&buf, binary.BigEndian, val)
 	if buf.Len() != dtype.storageSize() {
-		panic("invalid fill value")
+		return errBadFillValue
 	}
 	d := int64(buf.Len())
 	for ; begin < end; begin += d {
@@ -85,13 +110,16 @@ func fill(w io.WriterAt, begin, end int64, val interface{}, dtype datatype) erro
 }
 
 // Fill overwrites the data for non-record variable named v with its fill value.
-// Fill panics if v does not name a non-record variable.
+// Fill returns an error if v does not name a non-record variable.
 // If the variable has a scalar attribute '_FillValue' of the same data type as the variable,
 // it will be used, otherwise the type's default fill value will be used.
 func (f *File) Fill(v string) error {
 	vv := f.Header.varByName(v)
-	if vv == nil || vv.isRecordVariable() {
-		panic("Fill for non-record variable")
+	if vv == nil {
+		return ErrUnknownVariable
+	}
+	if vv.isRecordVariable() {
+		return errRecordVariable
 	}
 	return fill(f.rw, vv.begin, vv.begin+pad4(vv.vSize()), vv.fillValue(), vv.dtype)
 }
@@ -92,8 +92,8 @@ func readWriteCompareData(srcpath string, t *testing.T) {
 
 		//log.Print("copying ", v, "...")
 
-		r := src.Reader(v, nil, nil)
-		w := dst.Writer(v, nil, nil)
+		r := mustReader(t, src, v, nil, nil)
+		w := mustWriter(t, dst, v, nil, nil)
 		//log.Print("reader:", r)
 		//log.Print("writer:", w)
 		buf := r.Zero(-1)
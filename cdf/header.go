@@ -18,30 +18,40 @@ package cdf
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 )
 
-// A version of 1 indicates 32 bit offsets, a version of 2 indicates 64 bit offsets.
+// A version of 1 indicates 32 bit offsets, a version of 2 indicates 64 bit offsets,
+// a version of 5 (CDF-5, as written by PnetCDF) indicates 64 bit offsets, 64 bit
+// counts and lengths, and the unsigned and 64 bit integer data types.
 // All other versions, in particular V4 (which uses HDF as a backing store), are unsupported.
 type version byte
 
 const (
-	_V1 version = iota + 1 // 32 bit offsets
-	_V2                    // 64 bit offsets
+	_V1 version = 1 // 32 bit offsets
+	_V2 version = 2 // 64 bit offsets
+	_V5 version = 5 // 64 bit offsets and data
 )
 
-// String renders v as "V1" or "V2" if valid, "<42>" if invalid.
+// String renders v as "V1", "V2" or "V5" if valid, "<42>" if invalid.
 func (v version) String() string {
 	switch v {
 	case _V1:
 		return "V1"
 	case _V2:
 		return "V2"
+	case _V5:
+		return "V5"
 	}
 	return fmt.Sprintf("<%d>", byte(v))
 }
 
+// offs64 returns whether variable offsets are stored as 64 bit values.
+// Mutable headers (version 0) are sized as V1.
+func (v version) offs64() bool { return v == _V2 || v == _V5 }
+
 // A datatype encodes the NetCDF data type of a variable or attribute.
 type datatype int32
 
@@ -52,16 +62,30 @@ const (
 	_INT
 	_FLOAT
 	_DOUBLE
+	_UBYTE // the types below are only valid in V5 headers
+	_USHORT
+	_UINT
+	_INT64
+	_UINT64
 )
 
 // data type string and storage size tables.
 var (
-	dt2String      = [...]string{"", "BYTE", "CHAR", "SHORT", "INT", "FLOAT", "DOUBLE"}
-	dt2StorageSize = [...]int{0, 1, 1, 2, 4, 4, 8}
+	dt2String      = [...]string{"", "BYTE", "CHAR", "SHORT", "INT", "FLOAT", "DOUBLE", "UBYTE", "USHORT", "UINT", "INT64", "UINT64"}
+	dt2StorageSize = [...]int{0, 1, 1, 2, 4, 4, 8, 1, 2, 4, 8, 8}
 )
 
-// Valid returns whether d is one of the six defined types.
-func (d datatype) valid() bool { return d >= _BYTE && d <= _DOUBLE }
+// Valid returns whether d is one of the eleven defined types.
+func (d datatype) valid() bool { return d >= _BYTE && d <= _UINT64 }
+
+// ValidIn returns whether d is valid in a header of version v: the
+// classic V1 and V2 formats only know the first six types.
+func (d datatype) validIn(v version) bool {
+	if v == _V5 {
+		return d.valid()
+	}
+	return d >= _BYTE && d <= _DOUBLE
+}
 
 // StorageSize returns the number of bytes occupied by an element of the datatype.
 func (d datatype) storageSize() int {
@@ -87,6 +111,16 @@ func (d datatype) Zero(n int) interface{} {
 		return make([]float32, n)
 	case _DOUBLE:
 		return make([]float64, n)
+	case _UBYTE:
+		return make([]uint8, n)
+	case _USHORT:
+		return make([]uint16, n)
+	case _UINT:
+		return make([]uint32, n)
+	case _INT64:
+		return make([]int64, n)
+	case _UINT64:
+		return make([]uint64, n)
 	}
 	return nil
 }
@@ -94,7 +128,8 @@ func (d datatype) Zero(n int) interface{} {
 // DataTypeFromValues maps the type of val to its corresponding datatype.
 //
 // The only valid dynamic types of val are 
-// []int8, string, []int16, []int32, []float32 or []float64.
+// []int8, string, []int16, []int32, []float32, []float64,
+// []uint8, []uint16, []uint32, []int64 or []uint64.
 // Any other type of val returns the zero (invalid) datatype).
 func dataTypeFromValues(val interface{}) datatype {
 	switch val.(type) {
@@ -110,12 +145,22 @@ func dataTypeFromValues(val interface{}) datatype {
 		return _FLOAT
 	case []float64:
 		return _DOUBLE
+	case []uint8:
+		return _UBYTE
+	case []uint16:
+		return _USHORT
+	case []uint32:
+		return _UINT
+	case []int64:
+		return _INT64
+	case []uint64:
+		return _UINT64
 	}
 	return 0
 }
 
-// String renders the datatype as "BYTE", "CHAR", "SHORT", "INT", "FLOAT", "DOUBLE" or "<42>"
-// if the type is invalid.
+// String renders the datatype as "BYTE", "CHAR", "SHORT", "INT", "FLOAT", "DOUBLE",
+// "UBYTE", "USHORT", "UINT", "INT64", "UINT64" or "<42>" if the type is invalid.
 func (d datatype) String() string {
 	if d.valid() {
 		return dt2String[d]
@@ -138,6 +183,16 @@ func (d datatype) FillValue() interface{} {
 		return float32(9.9692099683868690e+36) // \x7C \xF0 \x00 \x00 
 	case _DOUBLE:
 		return float64(9.9692099683868690e+36) // \x47 \x9E \x00 \x00 \x00 \x00
+	case _UBYTE:
+		return uint8(255)
+	case _USHORT:
+		return uint16(65535)
+	case _UINT:
+		return uint32(4294967295)
+	case _INT64:
+		return int64(-9223372036854775806)
+	case _UINT64:
+		return uint64(18446744073709551614)
 	}
 	return nil
 }
@@ -148,14 +203,14 @@ func pad4(x int64) int64 { return (x + 3) &^ 3 }
 // A NetCDF dimension as represented in the header
 type dimension struct {
 	name   string
-	length int32
+	length int64
 }
 
 // An NetCDF global or variable attribute as represented in the header
 type attribute struct {
 	name   string
 	dtype  datatype
-	values interface{} // []int8, string, []int16, []int32, []float32 or []float64
+	values interface{} // []int8, string, []int16, []int32, []float32, []float64, []uint8, []uint16, []uint32, []int64 or []uint64
 }
 
 // Fprint writes a debug representation of the attribute in the form "[var]:name type = val"
@@ -181,7 +236,7 @@ type variable struct {
 	dim   []int32 // indices into header.dim
 	att   []attribute
 	dtype datatype
-	vsize int32 // set as per spec but not used by this library
+	vsize int64 // set as per spec but not used by this library
 	begin int64
 
 	// computed
@@ -213,15 +268,8 @@ func (v *variable) setComputed(dims []dimension) {
 	if vsize == 0 && len(v.strides) > 1 {
 		vsize = v.strides[1]
 	}
-	vsize = pad4(vsize)
-	// the spec is ambiguous, it says s > 1<<32-4...
-	// but the grammar says NON_NEG is a positive INT
-	// and INT is a signed 32 bit big endian, so we'll set it it 0xffff/-1 if 
-	if vsize > (1<<31 - 4) {
-		v.vsize = -1
-	} else {
-		v.vsize = int32(vsize)
-	}
+	// the value is clipped to 32 bits in V1 and V2 headers by writeTo.
+	v.vsize = pad4(vsize)
 }
 
 func (v *variable) offsetOf(idx []int) int64 {
@@ -267,6 +315,26 @@ func (v *variable) fillValue() interface{} {
 			if len(vv) == 1 {
 				return vv[0]
 			}
+		case []uint8:
+			if len(vv) == 1 {
+				return vv[0]
+			}
+		case []uint16:
+			if len(vv) == 1 {
+				return vv[0]
+			}
+		case []uint32:
+			if len(vv) == 1 {
+				return vv[0]
+			}
+		case []int64:
+			if len(vv) == 1 {
+				return vv[0]
+			}
+		case []uint64:
+			if len(vv) == 1 {
+				return vv[0]
+			}
 		default:
 			panic("invalid attribute value type")
 		}
@@ -282,16 +350,23 @@ func (v *variable) fillValue() interface{} {
 // 	http://www.unidata.ucar.edu/software/netcdf/docs/classic_format_spec.html
 //
 // A header read with ReadHeader can not be modified.  A header created with NewHeader
-// can be modified with AddVariable and AddAttribute until the call to Define.
+// or returned by File.Redef can be modified with AddVariable and AddAttribute until the
+// call to Define or File.EndDef respectively.
 //
 // The NetCDF defined 'numrecs' field is ignored on reading and set to -1
 // ('STREAMING') on writing of the header, but can be read and written
-// separately.
+// separately, as Open and the Appender do.
 type Header struct {
 	version version
 	dim     []dimension
 	att     []attribute
 	vars    []variable
+
+	// layout options set by DefineWithOptions, not stored in the file.
+	hMinFree, vAlign, rAlign int64
+
+	// the first error in NewHeader, AddVariable or AddAttribute, returned again by Define.
+	err error
 }
 
 // Find the index of the dimension named v, or return -1.
@@ -414,6 +489,16 @@ func (h *Header) IsRecordVariable(v string) bool {
 	return vv.isRecordVariable()
 }
 
+// IsCoordinateVariable returns true iff a variable named v exists and it is a coordinate variable,
+// i.e. it is 1-dimensional and has the same name as its dimension.
+func (h *Header) IsCoordinateVariable(v string) bool {
+	vv := h.varByName(v)
+	if vv == nil {
+		return false
+	}
+	return len(vv.dim) == 1 && h.dim[vv.dim[0]].name == v
+}
+
 // Variables returns a slice with the names of all variables defined in the header.
 func (h *Header) Variables() []string {
 	r := make([]string, len(h.vars))
@@ -444,7 +529,8 @@ func (h *Header) Attributes(v string) []string {
 // GetAttribute returns the value of the attribute a of variable
 // v or the global attribute a if v == "".  The returned
 // value is of type  []int8, string, []int16, []int32,
-// []float32 or []float64 and should not be modified by the caller,
+// []float32, []float64, []uint8, []uint16, []uint32, []int64 or []uint64
+// and should not be modified by the caller,
 // as it is shared by all callers.
 func (h *Header) GetAttribute(v, a string) interface{} {
 	attr := h.attrByName(v, a)
@@ -459,39 +545,59 @@ func (h *Header) GetAttribute(v, a string) interface{} {
 // dims and lengths specify the names and lengths of the dimensions.
 // Invalid dimension or size specifications, repeated dimension names,
 // as well as the occurence of more than 1 record dimension (size == 0) lead to panics.
+// Use MakeHeader to get an error instead.
 //
 // Until the call to h.Define() the version of the header will not be set, and the header will mutable,
 // meaning it can be modified by AddAttribute or AddVariable.
-func NewHeader(dims []string, lengths []int) *Header { return newHeader(0, dims, lengths) }
+func NewHeader(dims []string, lengths []int) *Header {
+	h, err := MakeHeader(dims, lengths)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// MakeHeader constructs a new CDF header like NewHeader, but returns an error for invalid dimensions
+// instead of panicking.
+func MakeHeader(dims []string, lengths []int) (*Header, error) {
+	h := newHeader(0, dims, lengths)
+	return h, h.err
+}
 
-// newheader constructs a new CDF header of the specified version.
+// newheader constructs a new CDF header of the specified version.  Any error in
+// the dimensions is stored in h.err, and then h has no dimensions.
 func newHeader(v version, dims []string, lengths []int) *Header {
+	h := &Header{version: v}
 	if len(dims) != len(lengths) {
-		panic("dims and sizes should be of same length")
+		h.err = errors.New("dims and sizes should be of same length")
+		return h
 	}
 
 	recdim := -1
 	for i, s := range dims {
 		if lengths[i] < 0 {
-			panic("invalid dimension length")
+			h.err = errors.New("invalid dimension length")
+			return h
 		}
 		if lengths[i] == 0 {
 			if recdim == -1 {
 				recdim = i
 			} else {
-				panic("multiple record dimensions")
+				h.err = errors.New("multiple record dimensions")
+				return h
 			}
 		}
 		for j, t := range dims {
 			if i != j && s == t {
-				panic("duplicate dimension name: " + s)
+				h.err = errors.New("duplicate dimension name: " + s)
+				return h
 			}
 		}
 	}
 
-	h := &Header{version: v, dim: make([]dimension, len(dims))}
+	h.dim = make([]dimension, len(dims))
 	for i, v := range dims {
-		h.dim[i] = dimension{name: v, length: int32(lengths[i])}
+		h.dim[i] = dimension{name: v, length: int64(lengths[i])}
 	}
 
 	return h
@@ -499,36 +605,39 @@ func newHeader(v version, dims []string, lengths []int) *Header {
 
 // AddVariable adds a variable of given type with the named dimensions to the header.
 //
-// Use of an existing variable name, or a nonexistent dimension name leads to a panic,
+// Use of an existing variable name, or a nonexistent dimension name leads to an error,
 // as does use of the record dimension for any other than the first.
 //
 // The datatype is determined from the dynamic type of val, which may be
-// one of []int8, string, []int16, []int32, []float32 or []float64.  Any
-// other type will lead to a panic.  The contents of val are ignored.
+// one of []int8, string, []int16, []int32, []float32 or []float64, or
+// one of the V5 types []uint8, []uint16, []uint32, []int64 or []uint64.  Any
+// other type will lead to an error.  The contents of val are ignored.
 //
-// The header must be mutable, i.e. created by NewHeader, not by ReadHeader.
-func (h *Header) AddVariable(v string, dims []string, val interface{}) {
+// The header must be mutable, i.e. created by NewHeader, not by ReadHeader, or
+// ErrHeaderImmutable is returned.  Other errors are also recorded in the header
+// and returned by Define, so they need not be checked for every call.
+func (h *Header) AddVariable(v string, dims []string, val interface{}) error {
 	if !h.isMutable() {
-		panic("cannot call AddVariable on an immutable header")
+		return ErrHeaderImmutable
 	}
 
 	if h.varByName(v) != nil {
-		panic("repeated add of variable " + v)
+		return h.setErr(errors.New("repeated add of variable " + v))
 	}
 
 	d := dataTypeFromValues(val)
 	if !d.valid() {
-		panic("invalid attribute value type")
+		return h.setErr(errors.New("invalid variable value type"))
 	}
 
 	dim := make([]int32, len(dims))
 	for i, dd := range dims {
 		d := h.dimByName(dd)
 		if d < 0 {
-			panic("invalid dimension")
+			return h.setErr(errors.New("invalid dimension: " + dd))
 		}
 		if h.dim[d].length == 0 && i != 0 {
-			panic("record dimension not outermost")
+			return h.setErr(errors.New("record dimension not outermost"))
 		}
 
 		dim[i] = int32(d)
@@ -536,38 +645,49 @@ func (h *Header) AddVariable(v string, dims []string, val interface{}) {
 
 	h.vars = append(h.vars, variable{name: v, dim: dim, dtype: d})
 	h.vars[len(h.vars)-1].setComputed(h.dim)
+	return nil
+}
+
+// setErr records err as h.err, unless there is one already, and returns it.
+func (h *Header) setErr(err error) error {
+	if h.err == nil {
+		h.err = err
+	}
+	return err
 }
 
 // AddAttribute adds an attribute named a to a variable named v, or to the global attributes
 // if v is the empty string.
 //
-// Use of a nonexistent variable name or an existent attribute name leads to a panic.
+// Use of a nonexistent variable name or an existent attribute name leads to an error.
 // The value can be of type []int8, string, []int16, []int32, []float32 or []float64, and will be stored
-// as NetCDF type  BYTE, CHAR, SHORT, INT, FLOAT, DOUBLE resp.
-// The header must be mutable, i.e. created by NewHeader, not by ReadHeader.
-func (h *Header) AddAttribute(v, a string, val interface{}) {
+// as NetCDF type  BYTE, CHAR, SHORT, INT, FLOAT, DOUBLE resp., or of type []uint8, []uint16, []uint32,
+// []int64 or []uint64, stored as UBYTE, USHORT, UINT, INT64, UINT64, which requires a V5 file.
+// The header must be mutable, as for AddVariable, and errors are recorded in the header in the same way.
+func (h *Header) AddAttribute(v, a string, val interface{}) error {
 	if !h.isMutable() {
-		panic("cannot call AddAttribute on an immutable header")
+		return ErrHeaderImmutable
 	}
 
 	att := &h.att
 	if v != "" {
 		vv := h.varByName(v)
 		if vv == nil {
-			panic("no such variable")
+			return h.setErr(ErrUnknownVariable)
 		}
 		att = &vv.att
 	}
 	for _, aa := range *att {
 		if aa.name == a {
-			panic("repeated add of attribute " + v + ":" + a)
+			return h.setErr(errors.New("repeated add of attribute " + v + ":" + a))
 		}
 	}
 	d := dataTypeFromValues(val)
 	if !d.valid() {
-		panic("invalid attribute value type")
+		return h.setErr(errors.New("invalid attribute value type"))
 	}
 	*att = append(*att, attribute{name: a, dtype: d, values: val})
+	return nil
 }
 
 // String returns a summary dump of the header, suitable for debugging.
@@ -681,8 +801,9 @@ func (h *Header) Check() (errs []error) {
 	d := int32(len(h.dim))
 	for v := range h.vars {
 		for i, x := range h.vars[v].dim {
-			if x < 0 || x > d {
+			if x < 0 || x >= d {
 				errs = append(errs, fmt.Errorf("invalid dimension %s[%d] = %d", h.vars[v].name, i, x))
+				continue
 			}
 			if h.dim[x].length == 0 && i != 0 {
 				errs = append(errs, fmt.Errorf("non-outer record dimension %s[%d]", h.vars[v].name, i))
@@ -749,7 +870,7 @@ func (h *Header) fixRecordStrides() {
 
 // DataStart returns the offset of the first variable.
 func (h *Header) dataStart() int64 {
-	if h.isMutable() {
+	if h.isMutable() || len(h.vars) == 0 {
 		return pad4(h.size())
 	}
 
@@ -765,16 +886,26 @@ func (h *Header) dataStart() int64 {
 	return ds
 }
 
-// Set the vars[*].begin fields starting at max(start, h.size)
+// round x up to the nearest multiple of a, which is itself rounded up to a multiple of 4.
+func align(x, a int64) int64 {
+	if a = pad4(a); a <= 4 {
+		return pad4(x)
+	}
+	return (x + a - 1) / a * a
+}
+
+// Set the vars[*].begin fields of the non-record variables starting at start and
+// of the record variables starting at rstart.  If the header does not fit before start,
+// the non-record variables start at h.size + h.hMinFree, aligned to h.vAlign, and if they
+// do not fit before rstart, the record variables start right after them, aligned to h.rAlign.
 // returns the values of the first and last offset.
 // if there are no variables, last will be zero
-func (h *Header) setOffsets(start int64) (first, last int64) {
-	offs := h.size()
-	if offs < start {
-		offs = start
+func (h *Header) setOffsets(start, rstart int64) (first, last int64) {
+	if sz := h.size(); sz > start {
+		start = align(sz+h.hMinFree, h.vAlign)
 	}
 
-	offs = pad4(offs)
+	offs := pad4(start)
 	first = offs
 
 	for i := range h.vars {
@@ -785,6 +916,11 @@ func (h *Header) setOffsets(start int64) (first, last int64) {
 		}
 	}
 
+	if offs > rstart {
+		rstart = align(offs, h.rAlign)
+	}
+	offs = pad4(rstart)
+
 	for i := range h.vars {
 		if h.vars[i].isRecordVariable() {
 			h.vars[i].begin = offs
@@ -799,21 +935,129 @@ func (h *Header) setOffsets(start int64) (first, last int64) {
 // as long as the version is not set, this is a mutable header
 func (h *Header) isMutable() bool { return h.version == 0 }
 
+// needsV5 returns whether the header can not be represented in the V1 or V2 format,
+// because it uses one of the V5 data types, a dimension longer than 2^31-1
+// or a variable larger than 4GiB.
+func (h *Header) needsV5() bool {
+	for i := range h.dim {
+		if h.dim[i].length > 1<<31-1 {
+			return true
+		}
+	}
+	for i := range h.att {
+		if !h.att[i].dtype.validIn(_V2) {
+			return true
+		}
+	}
+	for i := range h.vars {
+		if !h.vars[i].dtype.validIn(_V2) || h.vars[i].vsize > 1<<32-4 {
+			return true
+		}
+		for j := range h.vars[i].att {
+			if !h.vars[i].att[j].dtype.validIn(_V2) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Define makes a mutable header immutable by calculating the variable offsets and setting
-// the version number to V1 or V2, depending on whether the layout requires 64-bit offsets or not.
-func (h *Header) Define() {
+// the version number to V1 or V2, depending on whether the layout requires 64-bit offsets or not,
+// or to V5 if the header uses 64-bit data types or exceeds the V2 limits.
+//
+// If the header is immutable, Define returns ErrHeaderImmutable.  If an earlier call to MakeHeader,
+// AddVariable or AddAttribute failed, Define returns that error and the header remains mutable.
+func (h *Header) Define() error {
+	return h.DefineWithOptions(0, 0, 0)
+}
+
+// DefineWithOptions is like Define, but reserves at least hMinFree bytes between the
+// header and the data, and aligns the start of the non-record variables to a multiple
+// of vAlign and the start of the record variables to a multiple of rAlign, like the
+// NetCDF library's nc__enddef.  Alignments are rounded up to multiples of 4.
+//
+// The reserved space allows the header to grow in a later File.EndDef without moving the data.
+// Errors are returned as for Define.
+func (h *Header) DefineWithOptions(hMinFree, vAlign, rAlign int64) error {
+	if !h.isMutable() {
+		return ErrHeaderImmutable
+	}
+	if h.err != nil {
+		return h.err
+	}
+	h.hMinFree, h.vAlign, h.rAlign = hMinFree, vAlign, rAlign
+	h.define(0, 0, 0)
+	return nil
+}
+
+// DefineVersion is like Define, but sets the version to at least v, which must be 1 for
+// the classic format, 2 for the 64-bit offset format or 5 for the 64-bit data format.
+// The version can still be raised if the header does not fit v.
+func (h *Header) DefineVersion(v int) error {
+	switch version(v) {
+	case _V1, _V2, _V5:
+	default:
+		return errors.New("invalid version")
+	}
 	if !h.isMutable() {
-		panic("cannot Define an immutable header")
+		return ErrHeaderImmutable
 	}
+	if h.err != nil {
+		return h.err
+	}
+	h.define(version(v), 0, 0)
+	return nil
+}
 
+// Version returns the version of the file format of an immutable header: 1 for the classic format,
+// 2 for the 64-bit offset format or 5 for the 64-bit data format.  Mutable headers have version 0.
+func (h *Header) Version() int { return int(h.version) }
+
+// define sets the version to at least min and lays out the variables as per setOffsets(start, rstart).
+// For min == 0 the choice between V1 and V2 is made after
+// laying out with V2 sized offsets, as Define always did.
+func (h *Header) define(min version, start, rstart int64) {
 	h.fixRecordStrides()
 
-	// version must be set before call to dataStart/setOffsets.  Theoretically
+	// version must be set before call to setOffsets.  Theoretically
 	// writing 64 bit offsets instead of 32 bit can affect the value of dataStart.
-	h.version = _V2
-	if _, last := h.setOffsets(h.dataStart()); last < (1 << 31) {
+	switch {
+	case min == _V5 || h.needsV5():
+		h.version = _V5
+	case min == _V1:
 		h.version = _V1
+		if _, last := h.setOffsets(start, rstart); last < (1 << 31) {
+			return
+		}
+		h.version = _V2
+	default:
+		h.version = _V2
+		if _, last := h.setOffsets(start, rstart); last < (1<<31) && min == 0 {
+			h.version = _V1
+		}
+		return
 	}
+	h.setOffsets(start, rstart)
+}
+
+// mutableCopy returns a deep copy of h that can be modified with
+// AddVariable and AddAttribute.  Attribute values are shared.
+func (h *Header) mutableCopy() *Header {
+	c := &Header{dim: make([]dimension, len(h.dim)), att: make([]attribute, len(h.att)), vars: make([]variable, len(h.vars)),
+		hMinFree: h.hMinFree, vAlign: h.vAlign, rAlign: h.rAlign}
+	copy(c.dim, h.dim)
+	copy(c.att, h.att)
+	for i := range h.vars {
+		v := &c.vars[i]
+		v.name = h.vars[i].name
+		v.dim = append([]int32(nil), h.vars[i].dim...)
+		v.att = append([]attribute(nil), h.vars[i].att...)
+		v.dtype = h.vars[i].dtype
+		v.begin = h.vars[i].begin
+		v.setComputed(c.dim)
+	}
+	return c
 }
 
 func (h *Header) slabs() (offs, size int64) {
@@ -830,6 +1074,7 @@ func (h *Header) slabs() (offs, size int64) {
 }
 
 // numRecs computes the number or records from the filesize, returns the real number of records.
+// The last record counts even if the padding after the data of its last variable is missing.
 // For fsize < 0, returns -1.
 func (h *Header) NumRecs(fsize int64) int64 {
 	if fsize < 0 {
@@ -837,11 +1082,23 @@ func (h *Header) NumRecs(fsize int64) int64 {
 	}
 
 	offs, size := h.slabs()
+	data := h.recordDataSize()
 
-	if size == 0 || fsize < offs {
+	if size == 0 || fsize < offs+data {
 		return 0
 	}
 
-	nr := (fsize - offs) / size
+	nr := (fsize-offs-data)/size + 1
 	return nr
 }
+
+// recordDataSize returns the offset in a slab of the end of the data of the last record variable.
+func (h *Header) recordDataSize() (size int64) {
+	offs, _ := h.slabs()
+	for i := range h.vars {
+		if vv := &h.vars[i]; vv.isRecordVariable() && vv.begin-offs+vv.vSize() > size {
+			size = vv.begin - offs + vv.vSize()
+		}
+	}
+	return size
+}
@@ -19,6 +19,7 @@
 package cdf
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -86,7 +87,7 @@ func readWriteCompareHeader(srcpath string, t *testing.T) {
 	// cheat; normally this is done by Define, but we need bit for bit equality
 	dst.fixRecordStrides()
 	dst.version = src.version
-	dst.setOffsets(src.dataStart()) // dst.Define would use dst.dataStart
+	dst.setOffsets(src.dataStart(), 0) // dst.Define would use dst.dataStart
 
 	if errs := dst.Check(); errs != nil {
 		fmt.Println(dst)
@@ -112,7 +113,7 @@ func readWriteCompareHeader(srcpath string, t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if err := writeNumRecs(dstf, nr); err != nil {
+	if err := writeNumRecs(dstf, dst.version, nr); err != nil {
 		t.Error(err)
 	}
 
@@ -131,3 +132,168 @@ func readWriteCompareHeader(srcpath string, t *testing.T) {
 		}
 	}
 }
+
+func TestV5(t *testing.T) {
+	h := NewHeader([]string{"time", "x"}, []int{0, 3})
+	h.AddAttribute("", "flags", []uint16{1, 2, 3})
+	h.AddVariable("n", []string{"x"}, []int64{})
+	h.AddVariable("c", []string{"time", "x"}, []uint8{})
+	h.AddAttribute("c", "_FillValue", []uint8{7})
+	h.Define()
+
+	if h.version != _V5 {
+		t.Fatalf("expected version V5, got %v", h.version)
+	}
+	if errs := h.Check(); errs != nil {
+		t.Fatal(errs)
+	}
+
+	dstf, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dstf.Name())
+
+	f, err := Create(dstf, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := mustWriter(t, f, "n", nil, nil).Write([]int64{-1 << 40, 0, 1 << 40}); n != 3 {
+		t.Fatal("writing n:", n, err)
+	}
+	if err := f.FillRecord(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeNumRecs(dstf, h.version, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := Open(dstf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Header.String() != h.String() {
+		t.Errorf("header mismatch:\n%v\n%v", h, g.Header)
+	}
+	if nr, err := readNumRecs(dstf); nr != 1 || err != nil {
+		t.Error("numrecs:", nr, err)
+	}
+
+	n := make([]int64, 3)
+	if nn, err := mustReader(t, g, "n", nil, nil).Read(n); nn != 3 || n[0] != -1<<40 || n[2] != 1<<40 {
+		t.Error("reading n:", n, err)
+	}
+	c := make([]uint8, 3)
+	if nn, err := mustReader(t, g, "c", nil, []int{0, 2}).Read(c); nn != 3 || c[0] != 7 || c[2] != 7 {
+		t.Error("reading c:", c, err)
+	}
+}
+
+func TestDefineWithOptions(t *testing.T) {
+	h := NewHeader([]string{"time", "x"}, []int{0, 3})
+	h.AddVariable("a", []string{"x"}, []int16{})
+	h.AddVariable("r", []string{"time", "x"}, []float64{})
+	h.DefineWithOptions(1000, 512, 4096)
+
+	if errs := h.Check(); errs != nil {
+		t.Fatal(errs)
+	}
+	a, r := h.varByName("a").begin, h.varByName("r").begin
+	if a < h.size()+1000 || a%512 != 0 {
+		t.Error("bad offset for a:", a)
+	}
+	if r%4096 != 0 {
+		t.Error("bad offset for r:", r)
+	}
+
+	var buf bytes.Buffer
+	if err := h.WriteHeader(&buf); err != nil {
+		t.Fatal(err)
+	}
+	g, err := ReadHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := g.Check(); errs != nil {
+		t.Fatal(errs)
+	}
+	if g.String() != h.String() || g.dataStart() != a {
+		t.Errorf("header mismatch:\n%v\n%v", h, g)
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	if _, err := MakeHeader([]string{"x", "x"}, []int{1, 2}); err == nil {
+		t.Error("expected error for duplicate dimensions")
+	}
+
+	h := NewHeader([]string{"time", "x"}, []int{0, 2})
+	if err := h.AddVariable("a", []string{"x", "time"}, []int32{}); err == nil {
+		t.Error("expected error for record dimension not outermost")
+	}
+	if err := h.AddAttribute("b", "units", "m"); err != ErrUnknownVariable {
+		t.Error("expected ErrUnknownVariable, got", err)
+	}
+	if err := h.AddVariable("b", []string{"time", "x"}, []int32{}); err != nil {
+		t.Error(err)
+	}
+	if err := h.Define(); err == nil {
+		t.Error("expected the first error from Define")
+	}
+
+	ff, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(ff.Name())
+	defer ff.Close()
+	if _, err := Create(ff, h); err != ErrHeaderMutable {
+		t.Error("expected ErrHeaderMutable, got", err)
+	}
+
+	h = NewHeader([]string{"x"}, []int{2})
+	h.Define()
+	if err := h.AddVariable("a", []string{"x"}, []int32{}); err != ErrHeaderImmutable {
+		t.Error("expected ErrHeaderImmutable, got", err)
+	}
+}
+
+func TestInvalidDimension(t *testing.T) {
+	h := NewHeader([]string{"x", "y"}, []int{2, 3})
+	h.AddVariable("a", []string{"x", "y"}, []int32{})
+	h.Define()
+	h.vars[0].dim[1] = 2
+	if errs := h.Check(); len(errs) == 0 {
+		t.Error("expected error from Check")
+	}
+
+	var buf bytes.Buffer
+	if err := h.WriteHeader(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(&memStorage{data: buf.Bytes()}); err != badDimension {
+		t.Error("expected badDimension, got", err)
+	}
+}
+
+func TestDefineVersion(t *testing.T) {
+	for _, v := range []int{1, 2, 5} {
+		h := NewHeader([]string{"x"}, []int{3})
+		h.AddVariable("a", []string{"x"}, []int16{})
+		if h.Version() != 0 {
+			t.Error("mutable header has version", h.Version())
+		}
+		if err := h.DefineVersion(v); err != nil {
+			t.Fatal(err)
+		}
+		if h.Version() != v {
+			t.Errorf("expected version %d, got %d", v, h.Version())
+		}
+		if errs := h.Check(); errs != nil {
+			t.Fatal(errs)
+		}
+	}
+	if err := NewHeader(nil, nil).DefineVersion(3); err == nil {
+		t.Error("expected error for version 3")
+	}
+}
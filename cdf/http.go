@@ -0,0 +1,289 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains a read-only storage for files on HTTP servers.
+
+package cdf
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errNegativeOffset = errors.New("negative offset")
+	errContentRange   = errors.New("invalid Content-Range in HTTP response")
+)
+
+// An HTTPStatusError is returned for an unexpected HTTP response status.
+type HTTPStatusError struct {
+	URL    string
+	Status string
+	Code   int
+}
+
+func (e *HTTPStatusError) Error() string { return e.URL + ": " + e.Status }
+
+// An HTTPReaderAt is a read-only ReaderWriterAt for a file on an HTTP server, read with Range requests,
+// so that Open can read the header and Readers the requested data without downloading the whole file.
+//
+// The file is read in blocks of a fixed size, the most recently used of which are kept in a cache.
+// A ReadAt fetches all the blocks it needs that are not in the cache with a single request, so the
+// adjacent stripes of a strider mostly cost one request per block, and concurrent ReadAts wait
+// for the blocks that are already being fetched rather than fetching them again.
+// Requests that fail with a network error or a 5xx status are retried.
+//
+// WriteAt always returns an error.  The file should not change on the server while it is read.
+type HTTPReaderAt struct {
+	// Retries is the number of times a failed request is retried, after waiting Backoff,
+	// doubled at every retry.  NewHTTPReaderAt sets them to 3 and 100ms.
+	Retries int
+	Backoff time.Duration
+
+	client    *http.Client
+	url       string
+	size      int64
+	blockSize int64
+	capacity  int
+
+	mu     sync.Mutex
+	blocks map[int64]*httpBlock
+	lru    list.List // of *httpBlock in the cache, most recently used first
+}
+
+// an httpBlock is a block of the file, cached or being fetched.
+type httpBlock struct {
+	index int64
+	data  []byte
+	err   error
+	done  chan struct{} // closed when data or err is set
+	elem  *list.Element // in the lru, or nil while being fetched
+}
+
+// NewHTTPReaderAt returns an HTTPReaderAt for the file at url, read in blocks of blockSize bytes,
+// of which the most recently used blocks are cached.  If client is nil, http.DefaultClient is used.
+// The size of the file is taken from the response to a request for the first block, which is cached.
+func NewHTTPReaderAt(client *http.Client, url string, blockSize int64, blocks int) (*HTTPReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if blockSize <= 0 || blocks <= 0 {
+		return nil, fmt.Errorf("invalid block size %d or cache size %d", blockSize, blocks)
+	}
+	r := &HTTPReaderAt{
+		Retries:   3,
+		Backoff:   100 * time.Millisecond,
+		client:    client,
+		url:       url,
+		size:      -1,
+		blockSize: blockSize,
+		capacity:  blocks,
+		blocks:    make(map[int64]*httpBlock),
+	}
+	b := &httpBlock{index: 0, done: make(chan struct{})}
+	r.blocks[0] = b
+	if err := r.fetch([]*httpBlock{b}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Size returns the size of the file.
+func (r *HTTPReaderAt) Size() int64 { return r.size }
+
+// ReadAt reads len(p) bytes at offset off from the cache, fetching the missing blocks.
+// It returns io.EOF if fewer bytes are read because the file ends.
+func (r *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	if off >= end {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	first, last := off/r.blockSize, (end-1)/r.blockSize
+	blocks := make([]*httpBlock, 0, last-first+1)
+	var missing []*httpBlock
+	r.mu.Lock()
+	for i := first; i <= last; i++ {
+		b := r.blocks[i]
+		if b == nil {
+			b = &httpBlock{index: i, done: make(chan struct{})}
+			r.blocks[i] = b
+			missing = append(missing, b)
+		} else if b.elem != nil {
+			r.lru.MoveToFront(b.elem)
+		}
+		blocks = append(blocks, b)
+	}
+	r.mu.Unlock()
+
+	// fetch the runs of adjacent missing blocks, one request each.
+	for len(missing) > 0 {
+		k := 1
+		for k < len(missing) && missing[k].index == missing[k-1].index+1 {
+			k++
+		}
+		r.fetch(missing[:k])
+		missing = missing[k:]
+	}
+
+	n := 0
+	for _, b := range blocks {
+		<-b.done
+		if b.err != nil {
+			return n, b.err
+		}
+		boff := b.index * r.blockSize
+		lo := off + int64(n) - boff
+		n += copy(p[n:end-off], b.data[lo:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt returns an error, an HTTPReaderAt is read-only.
+func (r *HTTPReaderAt) WriteAt(p []byte, off int64) (int, error) { return 0, errReadOnly }
+
+// fetch gets the adjacent blocks bs with one Range request, retrying if it fails, and
+// moves them from being fetched to the cache, or removes them on error.
+func (r *HTTPReaderAt) fetch(bs []*httpBlock) error {
+	off := bs[0].index * r.blockSize
+	n := int64(len(bs)) * r.blockSize
+	data, err := r.get(off, n)
+	for i, wait := 0, r.Backoff; err != nil && i < r.Retries && retryable(err); i, wait = i+1, 2*wait {
+		time.Sleep(wait)
+		data, err = r.get(off, n)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, b := range bs {
+		if err != nil {
+			b.err = err
+			delete(r.blocks, b.index)
+		} else {
+			lo := int64(i) * r.blockSize
+			hi := lo + r.blockSize
+			if hi > int64(len(data)) {
+				hi = int64(len(data))
+			}
+			b.data = data[lo:hi:hi]
+			b.elem = r.lru.PushFront(b)
+		}
+		close(b.done)
+	}
+	for r.lru.Len() > r.capacity {
+		b := r.lru.Remove(r.lru.Back()).(*httpBlock)
+		delete(r.blocks, b.index)
+	}
+	return err
+}
+
+// get requests n bytes at off, or up to the end of the file, and sets the size of the file if
+// it is not known yet.  A server that ignores the Range header and sends the whole file
+// is accepted too.
+func (r *HTTPReaderAt) get(off, n int64) ([]byte, error) {
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	size := r.size
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != off {
+			return nil, errContentRange
+		}
+		if size < 0 {
+			size = total
+		}
+	case http.StatusOK:
+		if size < 0 {
+			size = resp.ContentLength
+		}
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return nil, noEOF(err)
+		}
+	default:
+		return nil, &HTTPStatusError{URL: r.url, Status: resp.Status, Code: resp.StatusCode}
+	}
+	if size < 0 {
+		return nil, errContentRange
+	}
+
+	if off+n > size {
+		n = size - off
+	}
+	if n < 0 {
+		n = 0
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, noEOF(err)
+	}
+	if r.size < 0 {
+		r.size = size // only while in NewHTTPReaderAt
+	}
+	return data, nil
+}
+
+// parseContentRange parses the start and total size from a Content-Range header
+// of the form "bytes start-end/size".
+func parseContentRange(s string) (start, size int64, err error) {
+	s, ok := strings.CutPrefix(s, "bytes ")
+	rng, total, ok2 := strings.Cut(s, "/")
+	first, _, ok3 := strings.Cut(rng, "-")
+	if !ok || !ok2 || !ok3 {
+		return 0, 0, errContentRange
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return 0, 0, errContentRange
+	}
+	if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+		return 0, 0, errContentRange
+	}
+	return start, size, nil
+}
+
+// retryable reports whether a request that failed with err may succeed when repeated.
+func retryable(err error) bool {
+	if e, ok := err.(*HTTPStatusError); ok {
+		return e.Code >= 500 || e.Code == http.StatusTooManyRequests
+	}
+	return err != errContentRange
+}
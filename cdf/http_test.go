@@ -0,0 +1,220 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// a testServer serves a file, counting the requests and failing the first fail of them.
+type testServer struct {
+	ra       io.ReaderAt
+	size     int64
+	requests int32
+	fail     int32
+	status   int  // of the failures
+	noRange  bool // ignore Range headers
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if atomic.AddInt32(&s.requests, 1) <= s.fail {
+		http.Error(w, "failed", s.status)
+		return
+	}
+	if s.noRange {
+		req.Header.Del("Range")
+	}
+	http.ServeContent(w, req, "", time.Time{}, io.NewSectionReader(s.ra, 0, s.size))
+}
+
+func newTestServer(t *testing.T, path string) (*testServer, *httptest.Server) {
+	ff, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := ff.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{ra: ff, size: fi.Size()}
+	return ts, httptest.NewServer(ts)
+}
+
+func newTestHTTPReaderAt(t *testing.T, url string, blockSize int64, blocks int) *HTTPReaderAt {
+	r, err := NewHTTPReaderAt(nil, url, blockSize, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Backoff = time.Millisecond
+	return r
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+	ts, srv := newTestServer(t, f.rw.(*os.File).Name())
+	defer srv.Close()
+	want, err := io.ReadAll(io.NewSectionReader(ts.ra, 0, ts.size))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestHTTPReaderAt(t, srv.URL, 64, 4)
+	if r.Size() != ts.size || ts.requests != 1 {
+		t.Fatalf("size %d, %d requests, expected %d, 1", r.Size(), ts.requests, ts.size)
+	}
+
+	for _, tc := range []struct {
+		off, n   int64
+		requests int32 // the expected number of new requests
+	}{
+		{0, 10, 0},    // block 0, fetched by NewHTTPReaderAt
+		{64, 200, 1},  // blocks 1-4 in one request, evicting block 0
+		{100, 100, 0}, // blocks 1-3, cached
+		{10, 100, 1},  // blocks 0-1, 0 was evicted
+		{300, 10, 1},  // block 4, evicted, evicting 2
+		{64, 320, 2},  // blocks 1-5, 2 was evicted, 5 is new
+		{ts.size - 5, 5, 1},
+	} {
+		before := ts.requests
+		p := make([]byte, tc.n)
+		if n, err := r.ReadAt(p, tc.off); n != len(p) || err != nil {
+			t.Fatalf("ReadAt(%d, %d): %d, %v", tc.off, tc.n, n, err)
+		}
+		if !bytes.Equal(p, want[tc.off:tc.off+tc.n]) {
+			t.Errorf("ReadAt(%d, %d): wrong data", tc.off, tc.n)
+		}
+		if ts.requests-before != tc.requests {
+			t.Errorf("ReadAt(%d, %d): %d requests, expected %d", tc.off, tc.n, ts.requests-before, tc.requests)
+		}
+	}
+
+	p := make([]byte, 20)
+	if n, err := r.ReadAt(p, ts.size-5); n != 5 || err != io.EOF || !bytes.Equal(p[:5], want[ts.size-5:]) {
+		t.Errorf("ReadAt at the end: %d, %v", n, err)
+	}
+	if _, err := r.WriteAt(p, 0); err != errReadOnly {
+		t.Error("expected errReadOnly, got", err)
+	}
+
+	// the File reads the same through HTTP.
+	hf, err := Open(newTestHTTPReaderAt(t, srv.URL, 64, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hf.Header.String() != f.Header.String() {
+		t.Errorf("header\n%s\nexpected\n%s", hf.Header, f.Header)
+	}
+	for _, v := range []string{"g", "f", "h"} {
+		end := []int{3, 4, 5}
+		if v == "h" {
+			end = []int{3}
+		}
+		a, b := hf.Header.ZeroValue(v, 60), f.Header.ZeroValue(v, 60)
+		mustReader(t, hf, v, nil, end).Read(a)
+		mustReader(t, f, v, nil, end).Read(b)
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("%s: %v, expected %v", v, a, b)
+		}
+	}
+}
+
+func TestHTTPReaderAtErrors(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+	ts, srv := newTestServer(t, f.rw.(*os.File).Name())
+	defer srv.Close()
+
+	ts.fail, ts.status = 2, http.StatusServiceUnavailable
+	r := newTestHTTPReaderAt(t, srv.URL, 64, 4)
+	if ts.requests != 3 {
+		t.Errorf("%d requests, expected 3", ts.requests)
+	}
+
+	ts.fail, ts.status = 3+4, http.StatusBadGateway
+	if _, err := r.ReadAt(make([]byte, 10), 100); err == nil || err.(*HTTPStatusError).Code != http.StatusBadGateway {
+		t.Error("expected a 502 error, got", err)
+	}
+	if ts.requests != 3+4 {
+		t.Errorf("%d requests, expected 7", ts.requests)
+	}
+	// the failure is not cached
+	if n, err := r.ReadAt(make([]byte, 10), 100); n != 10 || err != nil {
+		t.Error(n, err)
+	}
+
+	ts.requests, ts.fail, ts.status = 0, 1, http.StatusNotFound
+	if _, err := NewHTTPReaderAt(nil, srv.URL, 64, 4); err == nil || err.(*HTTPStatusError).Code != http.StatusNotFound {
+		t.Error("expected a 404 error, got", err)
+	}
+	if ts.requests != 1 {
+		t.Errorf("%d requests, expected 1", ts.requests)
+	}
+
+	ts.requests, ts.fail, ts.noRange = 0, 0, true
+	r = newTestHTTPReaderAt(t, srv.URL, 64, 4)
+	p := make([]byte, 100)
+	if n, err := r.ReadAt(p, 150); n != 100 || err != nil || r.Size() != ts.size {
+		t.Error("without ranges:", n, err, r.Size())
+	}
+}
+
+// TestHTTPTestdata reads the files in the test directory through HTTP, if there are any.
+func TestHTTPTestdata(t *testing.T) {
+	dir := os.Getenv("NETCDF_TESTDIR")
+	if dir == "" {
+		dir = "./testdata"
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.nc"))
+	if files == nil {
+		t.Skip("no files in " + dir)
+	}
+	for _, path := range files {
+		ts, srv := newTestServer(t, path)
+		r := newTestHTTPReaderAt(t, srv.URL, 1<<14, 16)
+		hf, err := Open(r)
+		if err != nil {
+			t.Error(path, err)
+		}
+		h, err := ReadHeader(io.NewSectionReader(ts.ra, 0, ts.size))
+		if err != nil {
+			t.Error(path, err)
+		}
+		if err == nil && hf != nil && hf.Header.String() != h.String() {
+			t.Errorf("%s: header differs", path)
+		}
+
+		a, b := make([]byte, 5000), make([]byte, 5000)
+		for off := int64(0); off < ts.size; off += 7919 {
+			n, _ := r.ReadAt(a, off)
+			m, _ := ts.ra.ReadAt(b, off)
+			if n != m || !bytes.Equal(a[:n], b[:m]) {
+				t.Errorf("%s: data differs at %d", path, off)
+				break
+			}
+		}
+		srv.Close()
+		ts.ra.(*os.File).Close()
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the code for mapped access to hyperslabs of CDF variables.
+
+package cdf
+
+import (
+	"errors"
+	"io"
+)
+
+var errBadMap = errors.New("invalid index map")
+
+// ReadMapped reads the elements of variable v in the box defined by start, count and stride
+// as for StridedReader into values, like nc_get_varm.  The element with index idx relative to
+// the box is stored in values[sum(idx[i] * imap[i])].  If imap is nil, the elements are stored
+// in row-major order.  Count may not be nil or contain -1.
+//
+// Values must be a slice of the type of the variable as for Reader.Read, and in row-major order at least
+// as long as the box.  ReadMapped returns the number of elements read, which is less than the number
+// of elements in the box only if err is set.
+func (f *File) ReadMapped(v string, start, count, stride, imap []int, values interface{}) (n int, err error) {
+	r, idx, tmp, total, err := f.mapped(v, start, count, stride, imap, values)
+	if err != nil {
+		return 0, err
+	}
+	if idx == nil {
+		n, err = r.Read(values)
+	} else {
+		n, err = r.Read(tmp)
+		permute(values, tmp, idx[:n], false)
+	}
+	if n == total && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// WriteMapped writes the elements of variable v in the box defined by start, count and stride
+// from values, which are mapped as for ReadMapped, like nc_put_varm.
+func (f *File) WriteMapped(v string, start, count, stride, imap []int, values interface{}) (n int, err error) {
+	r, idx, tmp, total, err := f.mapped(v, start, count, stride, imap, values)
+	if err != nil {
+		return 0, err
+	}
+	if idx == nil {
+		n, err = r.Write(values)
+	} else {
+		permute(values, tmp, idx, true)
+		n, err = r.Write(tmp)
+	}
+	if n == total && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// mapped returns the strider for the box and the number of elements in it, and if imap is not nil, the
+// index in values of each element of the box and a slice of the same type to read or write them.
+func (f *File) mapped(v string, start, count, stride, imap []int, values interface{}) (s interface {
+	Reader
+	Writer
+}, idx []int, tmp interface{}, total int, err error) {
+	if count == nil {
+		return nil, nil, nil, 0, ErrBadIndex
+	}
+	total = 1
+	for _, c := range count {
+		if c < 0 {
+			return nil, nil, nil, 0, ErrBadIndex
+		}
+		total *= c
+	}
+
+	if s, err = f.boxStrider(v, start, count, stride, -1); err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	if imap == nil {
+		if nv := permute(values, nil, nil, false); nv >= 0 && nv < total {
+			return nil, nil, nil, 0, ErrBadIndex
+		}
+		return s, nil, nil, total, nil
+	}
+	if len(imap) != len(count) {
+		return nil, nil, nil, 0, errBadMap
+	}
+
+	tmp = dataTypeFromValues(values).Zero(total)
+	if _, ok := tmp.(string); ok || tmp == nil {
+		return nil, nil, nil, 0, badValueType
+	}
+	nv := permute(values, nil, nil, false)
+
+	idx = make([]int, total)
+	pos := make([]int, len(count))
+	for k := range idx {
+		m := 0
+		for i, p := range pos {
+			m += p * imap[i]
+		}
+		if m < 0 || m >= nv {
+			return nil, nil, nil, 0, errBadMap
+		}
+		idx[k] = m
+		for i := len(pos) - 1; i >= 0; i-- {
+			if pos[i]++; pos[i] < count[i] {
+				break
+			}
+			pos[i] = 0
+		}
+	}
+	return s, idx, tmp, total, nil
+}
+
+// permute copies tmp[k] to values[idx[k]], or if gather is set, values[idx[k]] to tmp[k].
+// tmp must be a slice of the same type as values or nil.  Returns the length of values,
+// or -1 if values is not a slice of a valid type or a string.  A string is never permuted.
+func permute(values, tmp interface{}, idx []int, gather bool) int {
+	switch vv := values.(type) {
+	case string:
+		return len(vv)
+	case []int8:
+		if t, ok := tmp.([]int8); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []int16:
+		if t, ok := tmp.([]int16); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []int32:
+		if t, ok := tmp.([]int32); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []float32:
+		if t, ok := tmp.([]float32); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []float64:
+		if t, ok := tmp.([]float64); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []uint8:
+		if t, ok := tmp.([]uint8); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []uint16:
+		if t, ok := tmp.([]uint16); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []uint32:
+		if t, ok := tmp.([]uint32); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []int64:
+		if t, ok := tmp.([]int64); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	case []uint64:
+		if t, ok := tmp.([]uint64); ok {
+			for k, m := range idx {
+				if gather {
+					t[k] = vv[m]
+				} else {
+					vv[m] = t[k]
+				}
+			}
+		}
+		return len(vv)
+	}
+	return -1
+}
@@ -0,0 +1,77 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"testing"
+)
+
+func TestMapped(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+
+	// transpose the Y, Z plane at X == 2 for Y in [0,2), Z in [0,3)
+	buf := make([]int32, 6)
+	n, err := f.ReadMapped("g", []int{2, 0, 0}, []int{1, 2, 3}, nil, []int{0, 1, 2}, buf)
+	if n != 6 || err != nil {
+		t.Fatal("ReadMapped:", n, err)
+	}
+	exp := []int32{200, 210, 201, 211, 202, 212}
+	for i := range exp {
+		if buf[i] != exp[i] {
+			t.Fatalf("ReadMapped: got %v expected %v", buf, exp)
+		}
+	}
+
+	if _, err := f.ReadMapped("g", []int{2, 0, 0}, []int{1, 2, 3}, nil, []int{0, 1, 3}, buf); err == nil {
+		t.Error("expected error for index map out of range")
+	}
+
+	if n, err := f.ReadMapped("g", []int{2, 0, 0}, []int{1, 2, 3}, nil, nil, buf[:5]); n != 0 || err != ErrBadIndex {
+		t.Error("expected ErrBadIndex for short values, got", n, err)
+	}
+	if n, err := f.WriteMapped("g", []int{2, 0, 0}, []int{1, 2, 3}, nil, nil, buf[:5]); n != 0 || err != ErrBadIndex {
+		t.Error("expected ErrBadIndex for short values, got", n, err)
+	}
+
+	// write it back transposed, and read it in row-major order.
+	if n, err := f.WriteMapped("g", []int{3, 0, 0}, []int{1, 2, 3}, nil, []int{0, 1, 2}, buf); n != 6 || err != nil {
+		t.Fatal("WriteMapped:", n, err)
+	}
+	if n, err := f.ReadMapped("g", []int{3, 0, 0}, []int{1, 2, 3}, nil, nil, buf); n != 6 || err != nil {
+		t.Fatal("ReadMapped:", n, err)
+	}
+	exp = []int32{200, 201, 202, 210, 211, 212}
+	for i := range exp {
+		if buf[i] != exp[i] {
+			t.Fatalf("WriteMapped: got %v expected %v", buf, exp)
+		}
+	}
+}
+
+func TestMappedString(t *testing.T) {
+	h := NewHeader([]string{"x", "len"}, []int{2, 4})
+	h.AddVariable("c", []string{"x", "len"}, "")
+	h.Define()
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+
+	if n, err := f.WriteMapped("c", nil, []int{2, 4}, nil, nil, "abc"); n != 0 || err != ErrBadIndex {
+		t.Error("expected ErrBadIndex for short string, got", n, err)
+	}
+	if n, err := f.WriteMapped("c", nil, []int{2, 4}, nil, nil, "abcdefgh"); n != 8 || err != nil {
+		t.Error("WriteMapped:", n, err)
+	}
+}
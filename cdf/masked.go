@@ -0,0 +1,125 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the masking of missing data, following the attribute conventions of
+//	http://www.unidata.ucar.edu/software/netcdf/docs/attribute_conventions.html
+
+package cdf
+
+import (
+	"math"
+)
+
+// A Mask decides which stored values of a variable are missing.
+type Mask struct {
+	missing  []float64
+	min, max float64
+}
+
+// Mask returns the Mask for variable v, or nil if there is no such variable.
+// A stored value is missing if it is NaN, equal to the variable's fill value
+// (its _FillValue attribute or else the default for its type), equal to one of the
+// values of its missing_value attribute, or outside the range given by its
+// valid_range attribute or its valid_min and valid_max attributes.
+// These attributes apply to the stored values, not the unpacked ones.
+// Signed integer variables with an attribute _Unsigned = "true" are interpreted as unsigned.
+func (h *Header) Mask(v string) *Mask {
+	vv := h.varByName(v)
+	if vv == nil {
+		return nil
+	}
+	unsigned := h.isUnsigned(v) && (vv.dtype == _BYTE || vv.dtype == _SHORT || vv.dtype == _INT)
+
+	m := &Mask{missing: []float64{scalarFloat64(vv.fillValue(), unsigned)}, min: math.Inf(-1), max: math.Inf(1)}
+
+	if mv := h.GetAttribute(v, "missing_value"); attrLen(mv) > 0 {
+		x := make([]float64, attrLen(mv))
+		toFloat64(x, mv, unsigned)
+		m.missing = append(m.missing, x...)
+	}
+
+	if vr := h.GetAttribute(v, "valid_range"); attrLen(vr) == 2 {
+		var x [2]float64
+		toFloat64(x[:], vr, unsigned)
+		m.min, m.max = x[0], x[1]
+	} else {
+		var x [1]float64
+		if vr := h.GetAttribute(v, "valid_min"); attrLen(vr) == 1 {
+			toFloat64(x[:], vr, unsigned)
+			m.min = x[0]
+		}
+		if vr := h.GetAttribute(v, "valid_max"); attrLen(vr) == 1 {
+			toFloat64(x[:], vr, unsigned)
+			m.max = x[0]
+		}
+	}
+
+	return m
+}
+
+// Valid reports whether the stored value x is not missing.
+func (m *Mask) Valid(x float64) bool {
+	if math.IsNaN(x) || x < m.min || x > m.max {
+		return false
+	}
+	for _, v := range m.missing {
+		if x == v {
+			return false
+		}
+	}
+	return true
+}
+
+// A MaskedReader reads the elements of a numeric variable as unpacked floating point values,
+// like an UnpackingReader, replacing the values that are missing according to the variable's Mask by NaN.
+type MaskedReader struct {
+	r Reader
+	p *packing
+	m *Mask
+}
+
+// MaskedReader creates a MaskedReader for the elements of variable v from the corner
+// begin to end, with the same defaults as File.Reader.
+func (f *File) MaskedReader(v string, begin, end []int) (*MaskedReader, error) {
+	p, err := f.packing(v)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.Reader(v, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	return &MaskedReader{r: r, p: p, m: f.Header.Mask(v)}, nil
+}
+
+// Read reads len(values) elements into values.  If valid is not nil, valid[i] is set
+// to whether values[i] was present, otherwise values[i] will be NaN.
+// It returns the number of elements actually read.  If n < len(values), err will be set.
+func (r *MaskedReader) Read(values []float64, valid []bool) (n int, err error) {
+	buf := r.p.scratch(len(values))
+	n, err = r.r.Read(buf)
+	toFloat64(values[:n], buf, r.p.unsigned)
+	for i, v := range values[:n] {
+		ok := r.m.Valid(v)
+		if valid != nil {
+			valid[i] = ok
+		}
+		if ok {
+			values[i] = v*r.p.scale + r.p.offset
+		} else {
+			values[i] = math.NaN()
+		}
+	}
+	return n, err
+}
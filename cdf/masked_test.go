@@ -0,0 +1,77 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMasked(t *testing.T) {
+	h := NewHeader([]string{"x"}, []int{6})
+	h.AddVariable("s", []string{"x"}, []int16{})
+	h.AddAttribute("s", "_FillValue", []int16{-1})
+	h.AddAttribute("s", "missing_value", []int16{-2, -3})
+	h.AddAttribute("s", "valid_range", []int16{0, 100})
+	h.AddAttribute("s", "scale_factor", []float64{2})
+	h.AddVariable("d", []string{"x"}, []float64{})
+	h.AddAttribute("d", "valid_min", []float64{0})
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+
+	if n, _ := mustWriter(t, f, "s", nil, nil).Write([]int16{-1, -2, -3, 101, 100, 7}); n != 6 {
+		t.Fatal("writing s:", n)
+	}
+	if err := f.Fill("d"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := mustWriter(t, f, "d", nil, []int{3}).Write([]float64{-1, math.NaN(), 0, 1.5}); n != 4 {
+		t.Fatal("writing d:", n)
+	}
+
+	r, err := f.MaskedReader("s", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals := make([]float64, 6)
+	valid := make([]bool, 6)
+	if n, _ := r.Read(vals, valid); n != 6 {
+		t.Error("reading s:", n)
+	}
+	for i, ok := range []bool{false, false, false, false, true, true} {
+		if valid[i] != ok || ok == math.IsNaN(vals[i]) {
+			t.Errorf("s[%d]: got %v %v, expected valid: %v", i, vals[i], valid[i], ok)
+		}
+	}
+	if vals[4] != 200 || vals[5] != 14 {
+		t.Error("unpacked s:", vals)
+	}
+
+	// d[4:6] are the default fill value
+	r, err = f.MaskedReader("d", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.Read(vals, nil); n != 6 {
+		t.Error("reading d:", n)
+	}
+	for i, ok := range []bool{false, false, true, true, false, false} {
+		if ok == math.IsNaN(vals[i]) {
+			t.Errorf("d[%d]: got %v, expected valid: %v", i, vals[i], ok)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the read-only storage for memory-mapped files.
+
+package cdf
+
+import (
+	"io"
+	"os"
+)
+
+// An Mmap is a read-only ReaderWriterAt for a file mapped into memory.  The typed Readers
+// of a File opened on an Mmap decode the elements straight from the mapping into the values,
+// instead of reading every run of bytes with a ReadAt first.
+//
+// The file should not be truncated while it is mapped: accessing the pages past its end
+// raises a SIGBUS.  WriteAt always returns an error.
+type Mmap struct {
+	data []byte
+}
+
+// NewMmap maps the current contents of ff into memory.  Ff may be closed afterwards.
+// NewMmap returns an error on systems other than Linux.
+func NewMmap(ff *os.File) (*Mmap, error) {
+	fi, err := ff.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return &Mmap{}, nil
+	}
+	data, err := mmap(ff, fi.Size())
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: ff.Name(), Err: err}
+	}
+	return &Mmap{data: data}, nil
+}
+
+// OpenMmap maps ff into memory with NewMmap, and opens it like Open.  The Mmap must be
+// closed when the File is no longer used.  If Open returns a *NumRecsError, OpenMmap
+// returns the File, the Mmap and the error; on other errors the Mmap is closed.
+func OpenMmap(ff *os.File) (*File, *Mmap, error) {
+	m, err := NewMmap(ff)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := Open(m)
+	if _, ok := err.(*NumRecsError); err != nil && !ok {
+		m.Close()
+		return nil, nil, err
+	}
+	return f, m, err
+}
+
+// Close unmaps the file.  The Files opened on m must no longer be used.
+func (m *Mmap) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return munmap(data)
+}
+
+// Size returns the size of the mapped file.
+func (m *Mmap) Size() int64 { return int64(len(m.data)) }
+
+// ReadAt copies len(p) bytes at offset off from the mapping to p.
+func (m *Mmap) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt returns an error, an Mmap is read-only.
+func (m *Mmap) WriteAt(p []byte, off int64) (int, error) { return 0, errReadOnly }
+
+// A mapper is a storage mapped into memory, such as an Mmap.  Storage that wraps another may
+// implement it too, and return nil when the mapping can not be read directly.
+type mapper interface {
+	mapped() []byte
+}
+
+func (m *Mmap) mapped() []byte { return m.data }
+
+// readMapped is the io.ReadFull of readBytes for a strider on a storage mapped at data.
+// Every run is copied directly from the mapping into dst, rather than with a ReadAt.
+func (r *strider) readMapped(data, dst []byte) (int, error) {
+	return r.walk(len(dst), func(i int, off int64, k int) (int, error) {
+		if off >= int64(len(data)) {
+			return 0, io.EOF
+		}
+		var err error
+		if off+int64(k) > int64(len(data)) {
+			k, err = int(int64(len(data))-off), io.EOF
+		}
+		copy(dst[i:i+k], data[off:])
+		return k, err
+	})
+}
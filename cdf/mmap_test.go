@@ -0,0 +1,152 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package cdf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMmap(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+	mf, m, err := OpenMmap(f.rw.(*os.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if mf.Header.String() != f.Header.String() || mf.NumRecs() != 4 {
+		t.Errorf("header\n%s\nexpected\n%s", mf.Header, f.Header)
+	}
+	for _, tc := range []struct {
+		v                    string
+		start, count, stride []int
+	}{
+		{"g", nil, nil, nil},
+		{"g", []int{1, 2, 3}, []int{2, 3, 2}, []int{2, 1, 2}},
+		{"f", nil, nil, nil},
+		{"f", []int{1, 0, 1}, []int{-1, 2, 2}, []int{1, 3, 3}},
+		{"h", []int{1}, nil, nil},
+	} {
+		a, err := f.StridedReader(tc.v, tc.start, tc.count, tc.stride)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := mf.StridedReader(tc.v, tc.start, tc.count, tc.stride)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, y := a.Zero(200), b.Zero(200)
+		n, err := a.Read(x)
+		nn, err2 := b.Read(y)
+		if n != nn || err != err2 || !reflect.DeepEqual(x, y) {
+			t.Errorf("%v: mapped read %d %v %v, expected %d %v %v", tc, nn, err2, y, n, err, x)
+		}
+	}
+
+	var a, b bytes.Buffer
+	if err := f.WriteNpy(&a, "f", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := mf.WriteNpy(&b, "f", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("raw reads differ")
+	}
+
+	if _, err := mustWriter(t, mf, "g", nil, nil).Write(make([]int32, 10)); err != errReadOnly {
+		t.Error("expected errReadOnly, got", err)
+	}
+}
+
+func TestMmapTruncated(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+	data, err := ioutil.ReadAll(io.NewSectionReader(f.rw, 0, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cut the last record after the first element of f
+	ff, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(ff.Name())
+	defer ff.Close()
+	vf := f.Header.varByName("f")
+	if _, err := ff.Write(data[:vf.begin+3*vf.strides[1]+2]); err != nil {
+		t.Fatal(err)
+	}
+
+	mf, m, err := OpenMmap(ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for _, g := range []*File{{rw: ff, Header: mf.Header, numrecs: -1}, mf} {
+		r, err := g.StridedReader("f", nil, []int{4, 4, 5}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := make([]int16, 80)
+		if n, err := r.Read(x); n != 61 || err != io.EOF || x[60] != 300 {
+			t.Errorf("%T: read %d, %v, %v", g.rw, n, err, x[60])
+		}
+	}
+}
+
+func benchmarkRead(b *testing.B, mapped bool, v string) {
+	f, cleanup := createBenchFile(b)
+	defer cleanup()
+	if mapped {
+		mf, m, err := OpenMmap(f.rw.(*os.File))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer m.Close()
+		f = mf
+	}
+	n := 1
+	for _, l := range f.Header.Lengths(v)[1:] {
+		n *= l
+	}
+	n *= int(f.NumRecs())
+	values := f.Header.ZeroValue(v, n)
+	b.SetBytes(int64(n * f.Header.varByName(v).dtype.storageSize()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := f.Reader(v, nil, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if k, _ := r.Read(values); k != n {
+			b.Fatal("short read", k)
+		}
+	}
+}
+
+func BenchmarkReadFieldReadAt(b *testing.B)   { benchmarkRead(b, false, "t") }
+func BenchmarkReadFieldMmap(b *testing.B)     { benchmarkRead(b, true, "t") }
+func BenchmarkReadRecordsReadAt(b *testing.B) { benchmarkRead(b, false, "a") }
+func BenchmarkReadRecordsMmap(b *testing.B)   { benchmarkRead(b, true, "a") }
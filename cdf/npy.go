@@ -0,0 +1,258 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the export and import of variables in the NumPy .npy format
+//	https://numpy.org/doc/stable/reference/generated/numpy.lib.format.html
+
+package cdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	errNpyFormat  = errors.New("invalid .npy header")
+	errNpyType    = errors.New("unsupported .npy data type")
+	errNpyFortran = errors.New("fortran order .npy data is not supported")
+	errNpyShape   = errors.New(".npy shape does not match the dimensions")
+)
+
+const npyMagic = "\x93NUMPY"
+
+// the .npy type codes of the data types, without the byte order.
+var npyTypes = map[datatype]string{
+	_BYTE: "i1", _CHAR: "S1", _SHORT: "i2", _INT: "i4", _FLOAT: "f4", _DOUBLE: "f8",
+	_UBYTE: "u1", _USHORT: "u2", _UINT: "u4", _INT64: "i8", _UINT64: "u8",
+}
+
+// WriteNpy writes the elements of variable v in the box defined by start and count, as for StridedReader,
+// to w in the .npy format.  The array has the shape of the box, and a big-endian data type like '>i2'
+// or '>f8' so the data is copied as stored.  CHAR data is written as 'S1'.
+func (f *File) WriteNpy(w io.Writer, v string, start, count []int) error {
+	vv := f.Header.varByName(v)
+	if vv == nil {
+		return ErrUnknownVariable
+	}
+	if start != nil && len(start) != len(vv.dim) || count != nil && len(count) != len(vv.dim) {
+		return ErrBadIndex
+	}
+
+	// resolve the defaults, so the shape is known in advance.
+	shape := make([]int, len(vv.dim))
+	total := int64(1)
+	for i := range shape {
+		l := vv.lengths[i]
+		if i == 0 && vv.isRecordVariable() {
+			nr, err := f.recordCount()
+			if err != nil {
+				return err
+			}
+			l = int(nr)
+		}
+		if start != nil {
+			l -= start[i]
+		}
+		if count != nil && !(i == 0 && vv.isRecordVariable() && count[i] < 0) {
+			l = count[i]
+		}
+		if l < 0 {
+			l = 0
+		}
+		shape[i] = l
+		total *= int64(l)
+	}
+	s, _, err := f.rawBoxStrider(v, start, shape, nil, -1)
+	if err != nil {
+		return err
+	}
+
+	order := ">"
+	if vv.dtype.storageSize() == 1 {
+		order = "|"
+	}
+	dims := make([]string, len(shape))
+	for i, l := range shape {
+		dims[i] = strconv.Itoa(l)
+	}
+	tuple := "(" + strings.Join(dims, ", ") + ")"
+	if len(shape) == 1 {
+		tuple = "(" + dims[0] + ",)"
+	}
+	hdr := fmt.Sprintf("{'descr': '%s%s', 'fortran_order': False, 'shape': %s, }", order, npyTypes[vv.dtype], tuple)
+
+	// the data starts at a multiple of 64 bytes, the header ends in a newline.
+	hlen := len(npyMagic) + 4 + len(hdr) + 1
+	hdr += strings.Repeat(" ", (64-hlen%64)%64) + "\n"
+	pre := []byte(npyMagic + "\x01\x00")
+	pre = binary.LittleEndian.AppendUint16(pre, uint16(len(hdr)))
+	if _, err := w.Write(append(pre, hdr...)); err != nil {
+		return err
+	}
+
+	size := total * int64(vv.dtype.storageSize())
+	if n, err := io.CopyN(w, s, size); n < size {
+		return noEOF(err)
+	}
+	return nil
+}
+
+// A NpyReader reads an array in the .npy format, to be stored in a variable.
+type NpyReader struct {
+	Shape []int
+	dtype datatype
+	swap  bool // the data is little-endian
+	r     io.Reader
+}
+
+var (
+	npyDescr   = regexp.MustCompile(`['"]descr['"]\s*:\s*['"]([<>|=]?)([a-zA-Z]\d+)['"]`)
+	npyFortran = regexp.MustCompile(`['"]fortran_order['"]\s*:\s*(True|False)`)
+	npyShape   = regexp.MustCompile(`['"]shape['"]\s*:\s*\(([^)]*)\)`)
+)
+
+// NewNpyReader reads the header of a .npy file from r.  The array must be in C order and of
+// one of the integer or floating point types of the NetCDF format, or 'S1' for CHAR data.
+func NewNpyReader(r io.Reader) (*NpyReader, error) {
+	var pre [len(npyMagic) + 2]byte
+	if _, err := io.ReadFull(r, pre[:]); err != nil {
+		return nil, err
+	}
+	if string(pre[:len(npyMagic)]) != npyMagic {
+		return nil, errNpyFormat
+	}
+	var hlen int
+	switch pre[len(npyMagic)] {
+	case 1:
+		var l [2]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return nil, err
+		}
+		hlen = int(binary.LittleEndian.Uint16(l[:]))
+	case 2, 3:
+		var l [4]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return nil, err
+		}
+		hlen = int(binary.LittleEndian.Uint32(l[:]))
+	default:
+		return nil, errNpyFormat
+	}
+	hdr := make([]byte, hlen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+
+	descr, fortran, shape := npyDescr.FindSubmatch(hdr), npyFortran.FindSubmatch(hdr), npyShape.FindSubmatch(hdr)
+	if descr == nil || fortran == nil || shape == nil {
+		return nil, errNpyFormat
+	}
+	n := &NpyReader{r: r, dtype: -1}
+	for dt, code := range npyTypes {
+		if code == string(descr[2]) {
+			n.dtype = dt
+		}
+	}
+	if n.dtype < 0 {
+		return nil, errNpyType
+	}
+	n.swap = n.dtype.storageSize() > 1 && string(descr[1]) != ">"
+
+	for _, s := range strings.Split(string(shape[1]), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		l, err := strconv.Atoi(strings.TrimSuffix(s, "L"))
+		if err != nil || l < 0 {
+			return nil, errNpyFormat
+		}
+		n.Shape = append(n.Shape, l)
+	}
+	if string(fortran[1]) == "True" && len(n.Shape) > 1 {
+		return nil, errNpyFortran
+	}
+	return n, nil
+}
+
+// AddVariable adds a variable v with the data type of the array and dimensions dims to h,
+// as h.AddVariable does.  The lengths of the dimensions must match the shape of the array,
+// except that the record dimension matches any length.
+func (n *NpyReader) AddVariable(h *Header, v string, dims []string) error {
+	if len(dims) != len(n.Shape) {
+		return errNpyShape
+	}
+	for i, d := range dims {
+		j := h.dimByName(d)
+		if j < 0 || h.dim[j].length != 0 && h.dim[j].length != int64(n.Shape[i]) {
+			return errNpyShape
+		}
+	}
+	return h.AddVariable(v, dims, n.dtype.Zero(0))
+}
+
+// CopyTo writes the data of the array to variable v of f, which must have the data type of the array
+// and the dimensions of its shape, as added by AddVariable.  For a record variable, the first
+// Shape[0] records are written; as with File.Writer, the numrecs field is not updated.
+func (n *NpyReader) CopyTo(f *File, v string) error {
+	vv := f.Header.varByName(v)
+	if vv == nil {
+		return ErrUnknownVariable
+	}
+	if vv.dtype != n.dtype {
+		return badValueType
+	}
+	if len(vv.lengths) != len(n.Shape) {
+		return errNpyShape
+	}
+	end := make([]int, len(n.Shape))
+	size := int64(vv.dtype.storageSize())
+	for i, l := range n.Shape {
+		if vv.lengths[i] != l && !(i == 0 && vv.isRecordVariable()) {
+			return errNpyShape
+		}
+		if l == 0 {
+			return nil
+		}
+		end[i] = l - 1
+		size *= int64(l)
+	}
+	s, err := f.linearStrider(vv, nil, end)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1<<15) // a multiple of every element size
+	for size > 0 {
+		k := int64(len(buf))
+		if size < k {
+			k = size
+		}
+		if _, err := io.ReadFull(n.r, buf[:k]); err != nil {
+			return noEOF(err)
+		}
+		if n.swap {
+			reorder(buf[:k], vv.dtype.storageSize(), binary.LittleEndian, binary.BigEndian)
+		}
+		if m, err := s.Write(buf[:k]); int64(m) < k {
+			return err
+		}
+		size -= k
+	}
+	return nil
+}
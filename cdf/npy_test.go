@@ -0,0 +1,117 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestWriteNpy(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		v            string
+		start, count []int
+		descr, shape string
+		data         []byte
+	}{
+		{"g", []int{1, 2, 3}, []int{2, 1, 2}, "'>i4'", "(2, 1, 2)",
+			[]byte{0, 0, 0, 123, 0, 0, 0, 124, 0, 0, 0, 223, 0, 0, 0, 224}},
+		{"h", []int{2}, nil, "'>f8'", "(2,)",
+			[]byte{0x40, 0, 0, 0, 0, 0, 0, 0, 0x40, 0x08, 0, 0, 0, 0, 0, 0}},
+		{"f", nil, []int{-1, 0, 5}, "'>i2'", "(4, 0, 5)", nil},
+	} {
+		var buf bytes.Buffer
+		if err := f.WriteNpy(&buf, tc.v, tc.start, tc.count); err != nil {
+			t.Fatal(tc.v, err)
+		}
+		b := buf.Bytes()
+		if len(b) < 10 || string(b[:8]) != "\x93NUMPY\x01\x00" {
+			t.Fatalf("%s: bad magic %q", tc.v, b)
+		}
+		hlen := 10 + int(binary.LittleEndian.Uint16(b[8:]))
+		hdr := string(b[10:hlen])
+		if hlen%64 != 0 || !strings.HasSuffix(hdr, "\n") || !strings.Contains(hdr, "'descr': "+tc.descr) ||
+			!strings.Contains(hdr, "'shape': "+tc.shape) {
+			t.Errorf("%s: header %q", tc.v, hdr)
+		}
+		if !bytes.Equal(b[hlen:], tc.data) {
+			t.Errorf("%s: data %v, expected %v", tc.v, b[hlen:], tc.data)
+		}
+	}
+
+	if err := f.WriteNpy(new(bytes.Buffer), "g", []int{4, 0, 0}, []int{1, 1, 1}); err != ErrBadIndex {
+		t.Error("expected ErrBadIndex, got", err)
+	}
+}
+
+func TestNpyReader(t *testing.T) {
+	// little-endian, as numpy writes on most machines.
+	le := "\x93NUMPY\x01\x00" + "\x41\x00" + "{'descr': '<i2', 'fortran_order': False, 'shape': (2, 3), }" + strings.Repeat(" ", 5) + "\n" +
+		"\x01\x00\x02\x00\x03\x00\xff\xff\xfe\xff\xfd\xff"
+	n, err := NewNpyReader(strings.NewReader(le))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHeader([]string{"time", "x", "y"}, []int{0, 3, 2})
+	if err := n.AddVariable(h, "a", []string{"x", "y"}); err != errNpyShape {
+		t.Error("expected errNpyShape, got", err)
+	}
+	if err := n.AddVariable(h, "a", []string{"time", "x"}); err != nil {
+		t.Fatal(err)
+	}
+	h.AddVariable("b", []string{"time", "y"}, []float32{})
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+	if err := n.CopyTo(f, "a"); err != nil {
+		t.Fatal(err)
+	}
+	a, err := ReadVar[int16](f, "a", nil, []int{1, 2})
+	if err != nil || len(a) != 6 || a[0] != 1 || a[2] != 3 || a[3] != -1 || a[5] != -3 {
+		t.Error("reading a:", a, err)
+	}
+
+	// round trip through WriteNpy
+	var buf bytes.Buffer
+	if err := f.WriteNpy(&buf, "a", nil, []int{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = NewNpyReader(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Shape) != 2 || n.Shape[0] != 2 || n.Shape[1] != 3 || n.swap {
+		t.Error("shape:", n.Shape, n.swap)
+	}
+	if err := n.CopyTo(f, "b"); err != badValueType {
+		t.Error("expected badValueType, got", err)
+	}
+	if err := n.CopyTo(f, "a"); err != nil {
+		t.Error(err)
+	}
+	if b, err := ReadVar[int16](f, "a", nil, []int{1, 2}); err != nil || len(b) != 6 || b[5] != -3 {
+		t.Error("reading a back:", b, err)
+	}
+
+	if _, err := NewNpyReader(strings.NewReader(strings.Replace(le, "'<i2'", "'<c8'", 1))); err != errNpyType {
+		t.Error("expected errNpyType, got", err)
+	}
+}
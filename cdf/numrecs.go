@@ -17,24 +17,43 @@
 package cdf
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"sync/atomic"
 )
 
+var errUnknownNumRecs = errors.New("cannot determine the number of records")
+
 const _STREAMING = int32(-1) // value of numrecs meaning 'indeterminate'
 
-const _NumRecsOffset = 4 // position of the bigendian int32 in the header
+const _NumRecsOffset = 4 // position of the bigendian int32 (int64 in V5) in the header
 
+// readNumRecs reads the numrecs field, which is -1 for STREAMING.
+// The version byte in the magic determines the size of the field.
 func readNumRecs(r io.ReaderAt) (int64, error) {
-	var buf [4]byte
-	_, err := r.ReadAt(buf[:], _NumRecsOffset)
-	if err != nil {
+	var buf [_NumRecsOffset + 8]byte // any valid header is longer than this
+	if _, err := r.ReadAt(buf[:], 0); err != nil {
 		return 0, err
 	}
-	return int64(buf[0])<<24 + int64(buf[1])<<16 + int64(buf[2])<<8 + int64(buf[3]), nil
+	if version(buf[3]) == _V5 {
+		return int64(binary.BigEndian.Uint64(buf[_NumRecsOffset:])), nil
+	}
+	return int64(int32(binary.BigEndian.Uint32(buf[_NumRecsOffset:]))), nil
 }
 
-func writeNumRecs(w io.WriterAt, numrecs int64) error {
+func writeNumRecs(w io.WriterAt, v version, numrecs int64) error {
+	if v == _V5 {
+		if numrecs < 0 {
+			numrecs = -1
+		}
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(numrecs))
+		_, err := w.WriteAt(buf[:], _NumRecsOffset)
+		return err
+	}
 	if numrecs >= (1<<31) || numrecs < 0 {
 		numrecs = -1
 	}
@@ -43,6 +62,94 @@ func writeNumRecs(w io.WriterAt, numrecs int64) error {
 	return err
 }
 
+// A NumRecsError reports that the numrecs field of a file's header does not match the size of its storage.
+type NumRecsError struct {
+	NumRecs  int64 // the numrecs field
+	Complete int64 // the number of complete records in the storage
+	Partial  bool  // whether the storage has a trailing partial record
+}
+
+func (e *NumRecsError) Error() string {
+	if e.Complete < e.NumRecs {
+		return fmt.Sprintf("truncated file: numrecs is %d, but there are only %d complete records", e.NumRecs, e.Complete)
+	}
+	return fmt.Sprintf("partial record after %d complete records, numrecs is %d", e.Complete, e.NumRecs)
+}
+
+// storageSize returns the size of rw if it has a Stat or Size method, and the size is not negative.
+func storageSize(rw ReaderWriterAt) (int64, bool) {
+	switch s := rw.(type) {
+	case interface {
+		Stat() (os.FileInfo, error)
+	}:
+		fi, err := s.Stat()
+		if err != nil {
+			return 0, false
+		}
+		return fi.Size(), true
+	case interface {
+		Size() int64
+	}:
+		size := s.Size()
+		return size, size >= 0
+	}
+	return 0, false
+}
+
+// checkNumRecs checks the numrecs field against the size of the underlying storage, if it can be determined.
+func (f *File) checkNumRecs() error {
+	nr := atomic.LoadInt64(&f.numrecs)
+	offs, size := f.Header.slabs()
+	if nr < 0 || size == 0 {
+		return nil
+	}
+	fsize, ok := storageSize(f.rw)
+	if !ok {
+		return nil
+	}
+	complete := f.Header.NumRecs(fsize)
+	partial := fsize > pad4(offs+complete*size) // the unpadded records of a single record variable may be followed by padding
+	if complete < nr || partial {
+		return &NumRecsError{NumRecs: nr, Complete: complete, Partial: partial}
+	}
+	return nil
+}
+
+// NumRecs returns the number of records of f: the numrecs field of the header as read by Open
+// and updated by Appenders or, if the file is in STREAMING mode, the number of complete records
+// in the underlying storage.  If that can not be determined, NumRecs returns -1.
+func (f *File) NumRecs() int64 {
+	if nr := atomic.LoadInt64(&f.numrecs); nr >= 0 {
+		return nr
+	}
+	if fsize, ok := storageSize(f.rw); ok {
+		return f.Header.NumRecs(fsize)
+	}
+	return -1
+}
+
+// recordCount is like NumRecs, but returns an error if the number of records can not be determined.
+func (f *File) recordCount() (int64, error) {
+	if nr := f.NumRecs(); nr >= 0 {
+		return nr, nil
+	}
+	return 0, errUnknownNumRecs
+}
+
+// limitToRecords makes a strider over the records of vv end after the last committed record,
+// unless the file is in STREAMING mode.
+func (f *File) limitToRecords(s *strider, vv *variable) {
+	nr := atomic.LoadInt64(&f.numrecs)
+	if nr < 0 || !vv.isRecordVariable() {
+		return
+	}
+	s.end = vv.begin
+	if nr > 0 {
+		s.end += (nr-1)*vv.strides[1] + vv.strides[0]
+	}
+	s.checkEnd()
+}
+
 // UpdateNumRecs determines the number of record from the file size and
 // writes it into the file's header as the 'numrecs' field.
 //
@@ -51,10 +158,11 @@ func writeNumRecs(w io.WriterAt, numrecs int64) error {
 // Only valid headers will be updated.
 // After a succesful call f's filepointer will be left at the end of the file.
 //
-// This library does not use the numrecs header field but updating it
-// enables full bit for bit compatibility with other libraries.  There
+// Open uses the numrecs header field to limit the records that are read, and
+// updating it enables full bit for bit compatibility with other libraries.  There
 // is no need to call this function until after all updates by the program,
 // and it is rather costly because it reads, parses and checks the entire header.
+// To keep numrecs up to date while adding records, use an Appender instead.
 func UpdateNumRecs(f *os.File) error {
 	fi, err := f.Stat()
 	if err != nil {
@@ -79,7 +187,7 @@ func UpdateNumRecs(f *os.File) error {
 		return errs[0] // only room for the first
 	}
 
-	if err = writeNumRecs(f, h.NumRecs(fi.Size())); err != nil {
+	if err = writeNumRecs(f, h.version, h.NumRecs(fi.Size())); err != nil {
 		return err
 	}
 
@@ -0,0 +1,112 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNumRecs(t *testing.T) {
+	h := NewHeader([]string{"time", "x"}, []int{0, 2})
+	h.AddVariable("a", []string{"time", "x"}, []int32{})
+	h.AddVariable("b", []string{"time"}, []int16{})
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+	ff := f.rw.(*os.File)
+
+	a, err := f.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := 0; r < 3; r++ {
+		if _, err := a.Append(map[string]interface{}{"a": []int32{int32(r), int32(r)}, "b": []int16{int16(r)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an uncommitted complete record
+	if n, _ := mustWriter(t, f, "b", []int{3}, nil).Write([]int16{3}); n != 1 {
+		t.Fatal("writing b:", n)
+	}
+	if n, _ := mustWriter(t, f, "a", []int{3, 0}, nil).Write([]int32{3, 3}); n != 2 {
+		t.Fatal("writing a:", n)
+	}
+
+	g, err := Open(ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nr := g.NumRecs(); nr != 3 {
+		t.Error("NumRecs:", nr)
+	}
+	b := make([]int16, 5)
+	if n, _ := mustReader(t, g, "b", nil, nil).Read(b); n != 3 {
+		t.Error("reading b:", b[:n])
+	}
+	if n, _ := mustReader(t, g, "b", []int{2}, nil).Read(b); n != 1 || b[0] != 2 {
+		t.Error("reading b from 2:", b[:n])
+	}
+	r, err := g.StridedReader("b", []int{1}, nil, []int{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.Read(b); n != 1 || b[0] != 1 {
+		t.Error("reading b strided:", b[:n])
+	}
+	if bv, err := ReadVar[int16](g, "b", nil, nil); len(bv) != 3 || err != nil {
+		t.Error("ReadVar b:", bv, err)
+	}
+
+	// STREAMING reads up to EOF
+	if err := writeNumRecs(ff, h.version, -1); err != nil {
+		t.Fatal(err)
+	}
+	if g, err = Open(ff); err != nil {
+		t.Fatal(err)
+	}
+	if nr := g.NumRecs(); nr != 4 {
+		t.Error("streaming NumRecs:", nr)
+	}
+	if n, _ := mustReader(t, g, "b", nil, nil).Read(b); n != 4 {
+		t.Error("streaming reading b:", b[:n])
+	}
+	if err := writeNumRecs(ff, h.version, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// a trailing partial record
+	if n, _ := mustWriter(t, f, "a", []int{4, 0}, nil).Write([]int32{4}); n != 1 {
+		t.Fatal("writing a:", n)
+	}
+	g, err = Open(ff)
+	if e, ok := err.(*NumRecsError); !ok || e.NumRecs != 3 || e.Complete != 4 || !e.Partial {
+		t.Error("expected partial record error, got", err)
+	}
+	if g == nil || g.NumRecs() != 3 {
+		t.Error("file with partial record:", g)
+	}
+
+	// truncated
+	offs, size := h.slabs()
+	if err := ff.Truncate(offs + 2*size); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Open(ff)
+	if e, ok := err.(*NumRecsError); !ok || e.NumRecs != 3 || e.Complete != 2 || e.Partial {
+		t.Error("expected truncation error, got", err)
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the readers and writers for packed data, following the CF conventions
+//	http://cfconventions.org/Data/cf-conventions/cf-conventions-1.6/build/cf-conventions.html#packed-data
+
+package cdf
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	errNotNumeric = errors.New("variable is not numeric")
+	errPackRange  = errors.New("value out of range of packed type")
+)
+
+// attrFloat returns the value of the numeric scalar attribute a of variable v as a float64.
+func (h *Header) attrFloat(v, a string) (float64, bool) {
+	var x [1]float64
+	if vals := h.GetAttribute(v, a); attrLen(vals) == 1 && toFloat64(x[:], vals, false) {
+		return x[0], true
+	}
+	return 0, false
+}
+
+// attrLen returns the number of elements of an attribute value.
+func attrLen(vals interface{}) int {
+	switch vv := vals.(type) {
+	case []int8:
+		return len(vv)
+	case []int16:
+		return len(vv)
+	case []int32:
+		return len(vv)
+	case []float32:
+		return len(vv)
+	case []float64:
+		return len(vv)
+	case []uint8:
+		return len(vv)
+	case []uint16:
+		return len(vv)
+	case []uint32:
+		return len(vv)
+	case []int64:
+		return len(vv)
+	case []uint64:
+		return len(vv)
+	}
+	return -1
+}
+
+// isUnsigned reports whether the signed integer variable v has the _Unsigned = "true" attribute,
+// by which classic files mark their bytes, shorts or ints as unsigned.
+func (h *Header) isUnsigned(v string) bool {
+	s, ok := h.GetAttribute(v, "_Unsigned").(string)
+	return ok && s == "true"
+}
+
+// toFloat64 converts the first len(dst) elements of the numeric slice src to dst.
+// If unsigned is set, signed integers are interpreted as their unsigned counterparts.
+// It returns false if src is not a numeric slice.
+func toFloat64(dst []float64, src interface{}, unsigned bool) bool {
+	switch s := src.(type) {
+	case []int8:
+		for i := range dst {
+			if unsigned {
+				dst[i] = float64(uint8(s[i]))
+			} else {
+				dst[i] = float64(s[i])
+			}
+		}
+	case []int16:
+		for i := range dst {
+			if unsigned {
+				dst[i] = float64(uint16(s[i]))
+			} else {
+				dst[i] = float64(s[i])
+			}
+		}
+	case []int32:
+		for i := range dst {
+			if unsigned {
+				dst[i] = float64(uint32(s[i]))
+			} else {
+				dst[i] = float64(s[i])
+			}
+		}
+	case []float32:
+		for i := range dst {
+			dst[i] = float64(s[i])
+		}
+	case []float64:
+		copy(dst, s)
+	case []uint8:
+		for i := range dst {
+			dst[i] = float64(s[i])
+		}
+	case []uint16:
+		for i := range dst {
+			dst[i] = float64(s[i])
+		}
+	case []uint32:
+		for i := range dst {
+			dst[i] = float64(s[i])
+		}
+	case []int64:
+		for i := range dst {
+			dst[i] = float64(s[i])
+		}
+	case []uint64:
+		for i := range dst {
+			dst[i] = float64(s[i])
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// scalarFloat64 converts a numeric scalar as returned by variable.fillValue to a float64.
+// If unsigned is set, signed integers are interpreted as their unsigned counterparts.
+func scalarFloat64(x interface{}, unsigned bool) float64 {
+	switch v := x.(type) {
+	case int8:
+		if unsigned {
+			return float64(uint8(v))
+		}
+		return float64(v)
+	case int16:
+		if unsigned {
+			return float64(uint16(v))
+		}
+		return float64(v)
+	case int32:
+		if unsigned {
+			return float64(uint32(v))
+		}
+		return float64(v)
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return 0
+}
+
+// fromFloat64 converts src to the first len(src) elements of the numeric slice dst.
+// Values for integer types must be integral and in the range of the type or its unsigned
+// counterpart, in which case the bit pattern of the unsigned value is stored.
+func fromFloat64(dst interface{}, src []float64) {
+	switch d := dst.(type) {
+	case []int8:
+		for i, v := range src {
+			d[i] = int8(int64(v))
+		}
+	case []int16:
+		for i, v := range src {
+			d[i] = int16(int64(v))
+		}
+	case []int32:
+		for i, v := range src {
+			d[i] = int32(int64(v))
+		}
+	case []float32:
+		for i, v := range src {
+			d[i] = float32(v)
+		}
+	case []float64:
+		copy(d, src)
+	case []uint8:
+		for i, v := range src {
+			d[i] = uint8(v)
+		}
+	case []uint16:
+		for i, v := range src {
+			d[i] = uint16(v)
+		}
+	case []uint32:
+		for i, v := range src {
+			d[i] = uint32(v)
+		}
+	case []int64:
+		for i, v := range src {
+			d[i] = int64(v)
+		}
+	case []uint64:
+		for i, v := range src {
+			d[i] = uint64(v)
+		}
+	}
+}
+
+// bounds returns the range [lo, hi) of the values of the integer datatype d.
+func (d datatype) bounds(unsigned bool) (lo, hi float64) {
+	bits := float64(8 * d.storageSize())
+	switch d {
+	case _UBYTE, _USHORT, _UINT, _UINT64:
+		unsigned = true
+	}
+	if unsigned {
+		return 0, math.Exp2(bits)
+	}
+	return -math.Exp2(bits - 1), math.Exp2(bits - 1)
+}
+
+// packing holds the parameters to convert between stored and unpacked values of a variable.
+type packing struct {
+	dtype         datatype
+	unsigned      bool
+	scale, offset float64
+	fill          float64
+	buf           interface{}
+}
+
+func (f *File) packing(v string) (*packing, error) {
+	vv := f.Header.varByName(v)
+	if vv == nil {
+		return nil, ErrUnknownVariable
+	}
+	if vv.dtype == _CHAR {
+		return nil, errNotNumeric
+	}
+	p := &packing{dtype: vv.dtype, scale: 1}
+	p.unsigned = f.Header.isUnsigned(v) && (vv.dtype == _BYTE || vv.dtype == _SHORT || vv.dtype == _INT)
+	if x, ok := f.Header.attrFloat(v, "scale_factor"); ok {
+		p.scale = x
+	}
+	if x, ok := f.Header.attrFloat(v, "add_offset"); ok {
+		p.offset = x
+	}
+	p.fill = scalarFloat64(vv.fillValue(), p.unsigned)
+	return p, nil
+}
+
+// scratch returns a slice of the variable's type of length n, reusing the previous one if possible.
+func (p *packing) scratch(n int) interface{} {
+	if attrLen(p.buf) < n {
+		p.buf = p.dtype.Zero(n)
+	}
+	return truncate(p.buf, n)
+}
+
+// An UnpackingReader reads the elements of a numeric variable as floating point values,
+// applying the variable's scale_factor and add_offset attributes:
+//
+//	unpacked = stored * scale_factor + add_offset
+//
+// If absent, scale_factor defaults to 1 and add_offset to 0, so an UnpackingReader can be
+// used to read any numeric variable as floating point values.  Signed integer variables with
+// an attribute _Unsigned = "true" are interpreted as unsigned.
+type UnpackingReader struct {
+	r Reader
+	p *packing
+	f []float64
+}
+
+// UnpackingReader creates an UnpackingReader for the elements of variable v from the corner
+// begin to end, with the same defaults as File.Reader.
+func (f *File) UnpackingReader(v string, begin, end []int) (*UnpackingReader, error) {
+	p, err := f.packing(v)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.Reader(v, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	return &UnpackingReader{r: r, p: p}, nil
+}
+
+// Read reads len(values) elements into values.  It returns the number of elements
+// actually read.  If n < len(values), err will be set.
+func (r *UnpackingReader) Read(values []float64) (n int, err error) {
+	buf := r.p.scratch(len(values))
+	n, err = r.r.Read(buf)
+	toFloat64(values[:n], buf, r.p.unsigned)
+	for i := range values[:n] {
+		values[i] = values[i]*r.p.scale + r.p.offset
+	}
+	return n, err
+}
+
+// ReadFloat32 is like Read, but for float32 values.
+func (r *UnpackingReader) ReadFloat32(values []float32) (n int, err error) {
+	if len(r.f) < len(values) {
+		r.f = make([]float64, len(values))
+	}
+	n, err = r.Read(r.f[:len(values)])
+	for i, v := range r.f[:n] {
+		values[i] = float32(v)
+	}
+	return n, err
+}
+
+// A PackingWriter writes floating point values to a numeric variable, applying the inverse
+// of the variable's scale_factor and add_offset:
+//
+//	stored = round((unpacked - add_offset) / scale_factor)
+//
+// Rounding only applies to integer variables.  NaN values are stored as the variable's fill value.
+type PackingWriter struct {
+	w Writer
+	p *packing
+	q []float64
+}
+
+// PackingWriter creates a PackingWriter for the elements of variable v from the corner
+// begin to end, with the same defaults as File.Writer.
+func (f *File) PackingWriter(v string, begin, end []int) (*PackingWriter, error) {
+	p, err := f.packing(v)
+	if err != nil {
+		return nil, err
+	}
+	w, err := f.Writer(v, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	return &PackingWriter{w: w, p: p}, nil
+}
+
+// Write writes len(values) elements from values.  If a value does not fit the stored type
+// after packing, the preceding values are written and an error is returned.
+// If n < len(values), err will be set.
+func (w *PackingWriter) Write(values []float64) (n int, err error) {
+	if len(w.q) < len(values) {
+		w.q = make([]float64, len(values))
+	}
+	q := w.q[:len(values)]
+	isInt := w.p.dtype != _FLOAT && w.p.dtype != _DOUBLE
+	lo, hi := w.p.dtype.bounds(w.p.unsigned)
+	for i, v := range values {
+		if math.IsNaN(v) {
+			q[i] = w.p.fill
+			continue
+		}
+		x := (v - w.p.offset) / w.p.scale
+		if isInt {
+			x = math.Floor(x + .5)
+		}
+		if isInt && (x < lo || x >= hi) || w.p.dtype == _FLOAT && !math.IsInf(x, 0) && math.Abs(x) > math.MaxFloat32 {
+			q, err = q[:i], errPackRange
+			break
+		}
+		q[i] = x
+	}
+	buf := w.p.scratch(len(q))
+	fromFloat64(buf, q)
+	n, werr := w.w.Write(buf)
+	if n < len(q) || err == nil {
+		err = werr
+	}
+	return n, err
+}
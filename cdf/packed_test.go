@@ -0,0 +1,76 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPacked(t *testing.T) {
+	h := NewHeader([]string{"x"}, []int{5})
+	h.AddVariable("t", []string{"x"}, []int16{})
+	h.AddAttribute("t", "scale_factor", []float32{0.5})
+	h.AddAttribute("t", "add_offset", []float64{273})
+	h.AddVariable("u", []string{"x"}, []int8{})
+	h.AddAttribute("u", "_Unsigned", "true")
+	h.AddVariable("c", []string{"x"}, "")
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+
+	if _, err := f.UnpackingReader("c", nil, nil); err != errNotNumeric {
+		t.Error("expected errNotNumeric, got", err)
+	}
+
+	w, err := f.PackingWriter("t", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]float64{273, 274.2, math.NaN(), 200, 1e6}); n != 4 || err != errPackRange {
+		t.Error("writing t:", n, err)
+	}
+
+	var raw [4]int16
+	if n, _ := mustReader(t, f, "t", nil, []int{3}).Read(raw[:]); n != 4 || raw != [4]int16{0, 2, -32767, -146} {
+		t.Error("raw t:", n, raw)
+	}
+
+	r, err := f.UnpackingReader("t", nil, []int{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vals [4]float32
+	if n, _ := r.ReadFloat32(vals[:]); n != 4 || vals != [4]float32{273, 274, 273 - 32767*.5, 200} {
+		t.Error("unpacked t:", n, vals)
+	}
+
+	w, err = f.PackingWriter("u", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]float64{0, 1, 200, 255, 256}); n != 4 || err != errPackRange {
+		t.Error("writing u:", n, err)
+	}
+	r, err = f.UnpackingReader("u", nil, []int{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uvals [4]float64
+	if n, _ := r.Read(uvals[:]); n != 4 || uvals != [4]float64{0, 1, 200, 255} {
+		t.Error("unpacked u:", n, uvals)
+	}
+}
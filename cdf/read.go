@@ -30,12 +30,25 @@ var (
 	badTag           = errors.New("Invalid tag")
 	badLength        = errors.New("Invalid data length")
 	badAttributeType = errors.New("Invalid attribute storage type")
+	badDimension     = errors.New("Invalid dimension id")
 )
 
-// read an (int32, []byte) encoded string
-func readString(r io.Reader) (s string, err error) {
-	var nelems int32
-	if err = binary.Read(r, binary.BigEndian, &nelems); err != nil {
+// read a NON_NEG field: an int32, or an int64 for V5 headers.
+func readNonNeg(r io.Reader, v version) (int64, error) {
+	if v == _V5 {
+		var n int64
+		err := binary.Read(r, binary.BigEndian, &n)
+		return n, err
+	}
+	var n int32
+	err := binary.Read(r, binary.BigEndian, &n)
+	return int64(n), err
+}
+
+// read an (NON_NEG, []byte) encoded string
+func readString(r io.Reader, v version) (s string, err error) {
+	nelems, err := readNonNeg(r, v)
+	if err != nil {
 		return "", err
 	}
 	if nelems < 0 {
@@ -54,34 +67,35 @@ func readString(r io.Reader) (s string, err error) {
 }
 
 // used by readHeader
-func (d *dimension) readFrom(r io.Reader) (err error) {
-	if d.name, err = readString(r); err != nil {
+func (d *dimension) readFrom(r io.Reader, v version) (err error) {
+	if d.name, err = readString(r, v); err != nil {
 		return err
 	}
-	return binary.Read(r, binary.BigEndian, &d.length)
+	d.length, err = readNonNeg(r, v)
+	return err
 }
 
 // used by readHeader
-func (a *attribute) readFrom(r io.Reader) (err error) {
-	if a.name, err = readString(r); err != nil {
+func (a *attribute) readFrom(r io.Reader, v version) (err error) {
+	if a.name, err = readString(r, v); err != nil {
 		return err
 	}
 	if err = binary.Read(r, binary.BigEndian, &a.dtype); err != nil {
 		return err
 	}
-	if !a.dtype.valid() {
+	if !a.dtype.validIn(v) {
 		return badAttributeType
 	}
 
 	if a.dtype == _CHAR {
-		if a.values, err = readString(r); err != nil {
+		if a.values, err = readString(r, v); err != nil {
 			return err
 		}
 		return nil
 	}
 
-	var nelems int32
-	if err = binary.Read(r, binary.BigEndian, &nelems); err != nil {
+	nelems, err := readNonNeg(r, v)
+	if err != nil {
 		return err
 	}
 	if nelems < 0 {
@@ -99,6 +113,16 @@ func (a *attribute) readFrom(r io.Reader) (err error) {
 		a.values = make([]float32, nelems)
 	case _DOUBLE:
 		a.values = make([]float64, nelems)
+	case _UBYTE:
+		a.values = make([]uint8, int(nelems+3)&^3) // pad to multiple of 4 * 1
+	case _USHORT:
+		a.values = make([]uint16, int(nelems+1)&^1) // pad to multiple of 2 * 2
+	case _UINT:
+		a.values = make([]uint32, nelems)
+	case _INT64:
+		a.values = make([]int64, nelems)
+	case _UINT64:
+		a.values = make([]uint64, nelems)
 	}
 
 	if err = binary.Read(r, binary.BigEndian, a.values); err != nil {
@@ -110,33 +134,42 @@ func (a *attribute) readFrom(r io.Reader) (err error) {
 		a.values = a.values.([]int8)[:nelems]
 	case _SHORT:
 		a.values = a.values.([]int16)[:nelems]
+	case _UBYTE:
+		a.values = a.values.([]uint8)[:nelems]
+	case _USHORT:
+		a.values = a.values.([]uint16)[:nelems]
 	}
 
 	return nil
 }
 
 // used by readHeader
-func (v *variable) readFrom(r io.Reader, offs64 bool) (err error) {
-	var tag, nelems int32
+func (v *variable) readFrom(r io.Reader, vers version) (err error) {
+	var tag int32
 
-	if v.name, err = readString(r); err != nil {
+	if v.name, err = readString(r, vers); err != nil {
 		return err
 	}
 
-	if err = binary.Read(r, binary.BigEndian, &nelems); err != nil {
+	nelems, err := readNonNeg(r, vers)
+	if err != nil {
 		return err
 	}
 	if nelems < 0 {
 		return badLength
 	}
 	v.dim = make([]int32, nelems)
-	if err = binary.Read(r, binary.BigEndian, v.dim); err != nil {
-		return err
+	for i := range v.dim {
+		d, err := readNonNeg(r, vers)
+		if err != nil {
+			return err
+		}
+		v.dim[i] = int32(d)
 	}
 	if err = binary.Read(r, binary.BigEndian, &tag); err != nil {
 		return err
 	}
-	if err = binary.Read(r, binary.BigEndian, &nelems); err != nil {
+	if nelems, err = readNonNeg(r, vers); err != nil {
 		return err
 	}
 
@@ -146,9 +179,12 @@ func (v *variable) readFrom(r io.Reader, offs64 bool) (err error) {
 			return badLength
 		}
 	case 0xC:
+		if nelems < 0 {
+			return badLength
+		}
 		v.att = make([]attribute, nelems)
 		for i := range v.att {
-			if err = v.att[i].readFrom(r); err != nil {
+			if err = v.att[i].readFrom(r, vers); err != nil {
 				return err
 			}
 		}
@@ -160,11 +196,11 @@ func (v *variable) readFrom(r io.Reader, offs64 bool) (err error) {
 		return err
 	}
 
-	if err = binary.Read(r, binary.BigEndian, &v.vsize); err != nil {
+	if v.vsize, err = readNonNeg(r, vers); err != nil {
 		return err
 	}
 
-	if !offs64 {
+	if !vers.offs64() {
 		var b32 int32
 		if err = binary.Read(r, binary.BigEndian, &b32); err != nil {
 			return err
@@ -184,9 +220,9 @@ func (v *variable) readFrom(r io.Reader, offs64 bool) (err error) {
 // The returned header is immutable, meaning it may not be modified with AddVariable or AddAttribute.
 func ReadHeader(r io.Reader) (*Header, error) {
 	var (
-		magic       [3]byte
-		version     version
-		tag, nelems int32
+		magic   [3]byte
+		version version
+		tag     int32
 	)
 
 	if err := binary.Read(r, binary.BigEndian, &magic); err != nil {
@@ -201,14 +237,13 @@ func ReadHeader(r io.Reader) (*Header, error) {
 		return nil, err
 	}
 
-	if version != _V1 && version != _V2 {
+	if version != _V1 && version != _V2 && version != _V5 {
 		return nil, badVersion
 	}
 
 	h := &Header{version: version}
 
-	var numrecs int32 // ignored
-	if err := binary.Read(r, binary.BigEndian, &numrecs); err != nil {
+	if _, err := readNonNeg(r, version); err != nil { // numrecs, ignored
 		return nil, err
 	}
 
@@ -217,7 +252,8 @@ func ReadHeader(r io.Reader) (*Header, error) {
 		if err := binary.Read(r, binary.BigEndian, &tag); err != nil {
 			return nil, err
 		}
-		if err := binary.Read(r, binary.BigEndian, &nelems); err != nil {
+		nelems, err := readNonNeg(r, version)
+		if err != nil {
 			return nil, err
 		}
 		if nelems < 0 {
@@ -237,7 +273,7 @@ func ReadHeader(r io.Reader) (*Header, error) {
 
 			h.dim = make([]dimension, nelems)
 			for i := range h.dim {
-				if err := h.dim[i].readFrom(r); err != nil {
+				if err := h.dim[i].readFrom(r, h.version); err != nil {
 					return nil, err
 				}
 			}
@@ -249,9 +285,14 @@ func ReadHeader(r io.Reader) (*Header, error) {
 
 			h.vars = make([]variable, nelems)
 			for i := range h.vars {
-				if err := h.vars[i].readFrom(r, h.version == _V2); err != nil {
+				if err := h.vars[i].readFrom(r, h.version); err != nil {
 					return nil, err
 				}
+				for _, d := range h.vars[i].dim {
+					if d < 0 || d >= int32(len(h.dim)) {
+						return nil, badDimension
+					}
+				}
 				h.vars[i].setComputed(h.dim)
 			}
 
@@ -262,7 +303,7 @@ func ReadHeader(r io.Reader) (*Header, error) {
 
 			h.att = make([]attribute, nelems)
 			for i := range h.att {
-				if err := h.att[i].readFrom(r); err != nil {
+				if err := h.att[i].readFrom(r, h.version); err != nil {
 					return nil, err
 				}
 			}
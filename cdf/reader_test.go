@@ -138,7 +138,7 @@ func TestReader(t *testing.T) {
 	}
 
 	{
-		r := dst.Reader("x", nil, nil)
+		r := mustReader(t, dst, "x", nil, nil)
 		buf := r.Zero(-1)
 		if b, ok := buf.([]int32); !ok || len(b) != 9 {
 			t.Fatal("bad Zero for x", len(b))
@@ -161,7 +161,7 @@ func TestReader(t *testing.T) {
 	}
 
 	{
-		r := dst.Reader("y", nil, nil)
+		r := mustReader(t, dst, "y", nil, nil)
 		buf := r.Zero(-1)
 		if b, ok := buf.([]int16); !ok || len(b) != 7 {
 			t.Fatal("bad Zero for y")
@@ -184,7 +184,7 @@ func TestReader(t *testing.T) {
 	}
 
 	{
-		r := dst.Reader("z", nil, nil)
+		r := mustReader(t, dst, "z", nil, nil)
 		buf := r.Zero(-1)
 		if b, ok := buf.([]int8); !ok || len(b) != 5 {
 			t.Fatal("bad Zero for z")
@@ -206,7 +206,7 @@ func TestReader(t *testing.T) {
 	}
 
 	{
-		r := dst.Reader("f", nil, nil)
+		r := mustReader(t, dst, "f", nil, nil)
 		buf := r.Zero(-1)
 		if b, ok := buf.([]float32); !ok || len(b) != 5*7*9 {
 			t.Fatal("bad Zero for f")
@@ -249,3 +249,215 @@ func TestReader(t *testing.T) {
 	}
 
 }
+
+// create a file with a non-record variable g[X][Y][Z] and a record variable f[time][X][Y] with 4 records.
+func createBoxTestFile(t *testing.T) (*File, func()) {
+	h := NewHeader([]string{"time", "X", "Y", "Z"}, []int{0, 4, 5, 6})
+	h.AddVariable("g", []string{"X", "Y", "Z"}, []int32{})
+	h.AddVariable("f", []string{"time", "X", "Y"}, []int16{})
+	h.AddVariable("h", []string{"time"}, []float64{})
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+
+	g := make([]int32, 4*5*6)
+	for i := range g {
+		g[i] = int32(i/30*100 + i/6%5*10 + i%6)
+	}
+	if n, _ := mustWriter(t, f, "g", nil, nil).Write(g); n != len(g) {
+		t.Fatal("writing g:", n)
+	}
+	r := make([]int16, 4*4*5)
+	for i := range r {
+		r[i] = int16(i/20*100 + i/5%4*10 + i%5)
+	}
+	if n, _ := mustWriter(t, f, "f", nil, []int{3, 3, 4}).Write(r); n != len(r) {
+		t.Fatal("writing f:", n)
+	}
+	if n, _ := mustWriter(t, f, "h", nil, []int{3}).Write([]float64{0, 1, 2, 3}); n != 4 {
+		t.Fatal("writing h:", n)
+	}
+
+	return f, cleanup
+}
+
+// createTestFile creates a temporary file with the defined header h.
+func createTestFile(t testing.TB, h *Header) (*File, func()) {
+	ff, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Create(ff, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f, func() { ff.Close(); os.Remove(ff.Name()) }
+}
+
+// createBenchFile creates a file with records of a float32 field of 64x64, and two small variables.
+func createBenchFile(b *testing.B) (*File, func()) {
+	h := NewHeader([]string{"time", "y", "x"}, []int{0, 64, 64})
+	h.AddVariable("t", []string{"time", "y", "x"}, []float32{})
+	h.AddVariable("a", []string{"time"}, []int16{})
+	h.AddVariable("c", []string{"time"}, []float64{})
+	h.Define()
+
+	ff, err := ioutil.TempFile("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	f, err := Create(ff, h)
+	if err != nil {
+		b.Fatal(err)
+	}
+	const nrec = 200
+	w, _ := f.Writer("t", nil, []int{nrec - 1, 63, 63})
+	if _, err := w.Write(make([]float32, nrec*64*64)); err != nil && err != io.EOF {
+		b.Fatal(err)
+	}
+	w, _ = f.Writer("a", nil, []int{nrec - 1})
+	if _, err := w.Write(make([]int16, nrec)); err != nil && err != io.EOF {
+		b.Fatal(err)
+	}
+	return f, func() { ff.Close(); os.Remove(ff.Name()) }
+}
+
+func mustReader(t *testing.T, f *File, v string, begin, end []int) Reader {
+	r, err := f.Reader(v, begin, end)
+	if err != nil {
+		t.Fatal(v, err)
+	}
+	return r
+}
+
+func mustWriter(t *testing.T, f *File, v string, begin, end []int) Writer {
+	w, err := f.Writer(v, begin, end)
+	if err != nil {
+		t.Fatal(v, err)
+	}
+	return w
+}
+
+func TestReaderErrors(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+
+	if _, err := f.Reader("nosuchvar", nil, nil); err != ErrUnknownVariable {
+		t.Error("expected ErrUnknownVariable, got", err)
+	}
+	if _, err := f.Reader("g", []int{1, 2}, nil); err != ErrBadIndex {
+		t.Error("expected ErrBadIndex, got", err)
+	}
+	if _, err := f.Writer("f", nil, []int{1}); err != ErrBadIndex {
+		t.Error("expected ErrBadIndex, got", err)
+	}
+	if err := f.Fill("nosuchvar"); err != ErrUnknownVariable {
+		t.Error("expected ErrUnknownVariable, got", err)
+	}
+	if err := f.Fill("h"); err == nil {
+		t.Error("expected error filling record variable")
+	}
+}
+
+func TestStridedReader(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+
+	r, err := f.StridedReader("g", []int{1, 0, 1}, []int{2, 3, 2}, []int{2, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]int32, 13)
+	n, err := r.Read(buf)
+	exp := []int32{101, 104, 121, 124, 141, 144, 301, 304, 321, 324, 341, 344}
+	if n != len(exp) || err == nil {
+		t.Error("reading g box:", n, err)
+	}
+	for i, v := range exp {
+		if buf[i] != v {
+			t.Errorf("g box: got %v, expected %v", buf[:n], exp)
+			break
+		}
+	}
+
+	// every other record, all of X, Y[1:3]
+	r, err = f.StridedReader("f", []int{0, 0, 1}, []int{-1, 4, 2}, []int{2, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rbuf := make([]int16, 17)
+	n, err = r.Read(rbuf)
+	if n != 16 || err != io.EOF {
+		t.Error("reading f box:", n, err)
+	}
+	for i, v := range rbuf[:n] {
+		if e := int16(i/8*200 + i/2%4*10 + i%2 + 1); v != e {
+			t.Errorf("f box: got %v at %d expected %v", v, i, e)
+			break
+		}
+	}
+
+	// a linear Reader of a record variable that starts inside a record
+	rbuf = make([]int16, 15)
+	n, _ = mustReader(t, f, "f", []int{1, 2, 3}, []int{2, 1, 1}).Read(rbuf)
+	exp16 := []int16{123, 124, 130, 131, 132, 133, 134, 200, 201, 202, 203, 204, 210, 211}
+	if n != len(exp16) {
+		t.Error("reading f from [1 2 3]:", n)
+	}
+	for i, v := range exp16 {
+		if rbuf[i] != v {
+			t.Errorf("f from [1 2 3]: got %v, expected %v", rbuf[:n], exp16)
+			break
+		}
+	}
+
+	if _, err := f.StridedReader("g", nil, []int{5, 1, 1}, nil); err == nil {
+		t.Error("expected error for count out of range")
+	}
+	if _, err := f.StridedReader("nope", nil, nil, nil); err == nil {
+		t.Error("expected error for unknown variable")
+	}
+}
+
+func TestStridedWriter(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+
+	w, err := f.StridedWriter("g", []int{0, 1, 0}, []int{4, 1, 3}, []int{1, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]int32{-1, -2, -3, -4, -5, -6, -7, -8, -9, -10, -11, -12}); n != 12 {
+		t.Fatal("writing g box:", n, err)
+	}
+
+	g := make([]int32, 4*5*6)
+	if n, _ := mustReader(t, f, "g", nil, nil).Read(g); n != len(g) {
+		t.Fatal("reading g:", n)
+	}
+	k := int32(-1)
+	for i, v := range g {
+		e := int32(i/30*100 + i/6%5*10 + i%6)
+		if i/6%5 == 1 && i%2 == 0 {
+			e, k = k, k-1
+		}
+		if v != e {
+			t.Errorf("g[%d]: got %d expected %d", i, v, e)
+		}
+	}
+
+	// extend the record variable h with 2 records after a gap of 1
+	w, err = f.StridedWriter("h", []int{5}, []int{2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]float64{5, 6}); n != 2 {
+		t.Fatal("writing h:", n, err)
+	}
+	h := make([]float64, 2)
+	if n, _ := mustReader(t, f, "h", []int{5}, []int{6}).Read(h); n != 2 || h[0] != 5 || h[1] != 6 {
+		t.Error("reading h:", h)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the code to redefine the header of an existing file.
+
+package cdf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+)
+
+var errNotRedef = errors.New("EndDef must be called with the header returned by Redef")
+
+// Redef returns a mutable copy of f's header, to which variables and
+// attributes can be added with AddVariable and AddAttribute.  The changes
+// take effect on the call to f.EndDef, until then f remains usable with
+// its current header.
+func (f *File) Redef() *Header { return f.Header.mutableCopy() }
+
+// EndDef makes h, which must have been returned by f.Redef, the header of f.
+//
+// If the new header no longer fits before the data section, or the layout of the
+// variables changed because of added variables, the existing data is moved
+// to the new offsets, leaving room for the header to grow as per DefineWithOptions
+// if that was used to define f's header in this process.  Variables added since Redef are filled with their fill values.
+// The version of the file is upgraded as needed to V2 or V5, but never downgraded.
+//
+// Moving record variables requires the number of records, which is taken
+// from the numrecs field or, if that is STREAMING, from the size of the underlying
+// storage if it has a Stat method like *os.File.
+func (f *File) EndDef(h *Header) error {
+	old := f.Header
+	if !h.isMutable() || len(h.vars) < len(old.vars) {
+		return errNotRedef
+	}
+	for i := range old.vars {
+		if h.vars[i].name != old.vars[i].name {
+			return errNotRedef
+		}
+	}
+
+	// keep the data where it is if the new layout allows it.
+	rstart, _ := old.slabs()
+	h.define(old.version, old.dataStart(), rstart)
+
+	var nr int64
+	for i := range h.vars {
+		if h.vars[i].isRecordVariable() {
+			var err error
+			if nr, err = f.recordCount(); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	// Variables move up to make room, or down if the old layout had gaps.  Both layouts
+	// have the variables in the order of the header, so moving down in ascending order
+	// and up in descending order never overwrites data that still has to be moved.
+	type span struct{ dst, src, n int64 }
+	var moves []span
+	_, oslab := old.slabs()
+	_, nslab := h.slabs()
+	for i := range old.vars {
+		ov, nv := &old.vars[i], &h.vars[i]
+		if !ov.isRecordVariable() {
+			moves = append(moves, span{nv.begin, ov.begin, ov.vSize()})
+			continue
+		}
+		for r := int64(0); r < nr; r++ {
+			moves = append(moves, span{nv.begin + r*nslab, ov.begin + r*oslab, ov.vSize()})
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i].src < moves[j].src })
+	for _, m := range moves {
+		if m.dst < m.src {
+			if err := move(f.rw, m.dst, m.src, m.n); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(moves) - 1; i >= 0; i-- {
+		if m := moves[i]; m.dst > m.src {
+			if err := move(f.rw, m.dst, m.src, m.n); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(old.vars); i < len(h.vars); i++ {
+		vv := &h.vars[i]
+		if !vv.isRecordVariable() {
+			if err := fill(f.rw, vv.begin, vv.begin+pad4(vv.vSize()), vv.fillValue(), vv.dtype); err != nil {
+				return err
+			}
+			continue
+		}
+		for r := int64(0); r < nr; r++ {
+			begin := vv.begin + r*nslab
+			if err := fill(f.rw, begin, begin+pad4(vv.vSize()), vv.fillValue(), vv.dtype); err != nil {
+				return err
+			}
+		}
+	}
+
+	numrecs, err := readNumRecs(f.rw)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := h.WriteHeader(&buf); err != nil {
+		return err
+	}
+	if _, err := f.rw.WriteAt(buf.Bytes(), 0); err != nil {
+		return err
+	}
+	if numrecs >= 0 {
+		if err := writeNumRecs(f.rw, h.version, numrecs); err != nil {
+			return err
+		}
+	}
+
+	f.Header = h
+	return nil
+}
+
+// move copies n bytes from offset src to offset dst, which may overlap.
+// Data missing at the end of the storage is treated as zeroes.
+func move(rw ReaderWriterAt, dst, src, n int64) error {
+	if dst == src || n == 0 {
+		return nil
+	}
+	bsz := int64(1 << 20)
+	if bsz > n {
+		bsz = n
+	}
+	buf := make([]byte, bsz)
+
+	copyAt := func(offs int64) error {
+		k := n - offs
+		if k > bsz {
+			k = bsz
+		}
+		nr, err := rw.ReadAt(buf[:k], src+offs)
+		if err == io.EOF {
+			for i := range buf[nr:k] {
+				buf[nr+i] = 0
+			}
+		} else if err != nil {
+			return err
+		}
+		_, err = rw.WriteAt(buf[:k], dst+offs)
+		return err
+	}
+
+	if dst < src {
+		for offs := int64(0); offs < n; offs += bsz {
+			if err := copyAt(offs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for offs := (n - 1) / bsz * bsz; offs >= 0; offs -= bsz {
+		if err := copyAt(offs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedef(t *testing.T) {
+	h := NewHeader([]string{"time", "x"}, []int{0, 4})
+	h.AddVariable("a", []string{"x"}, []int32{})
+	h.AddVariable("r", []string{"time", "x"}, []int16{})
+	h.AddVariable("q", []string{"time"}, []float32{})
+	h.Define()
+
+	ff, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(ff.Name())
+
+	f, err := Create(ff, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := mustWriter(t, f, "a", nil, nil).Write([]int32{0, 1, 2, 3}); n != 4 {
+		t.Fatal(err)
+	}
+	if n, err := mustWriter(t, f, "r", nil, []int{2, 3}).Write([]int16{0, 1, 2, 3, 10, 11, 12, 13, 20, 21, 22, 23}); n != 12 {
+		t.Fatal(err)
+	}
+	if n, err := mustWriter(t, f, "q", nil, []int{2}).Write([]float32{.5, 1.5, 2.5}); n != 3 {
+		t.Fatal(err)
+	}
+	if err := writeNumRecs(ff, h.version, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	nh := f.Redef()
+	nh.AddAttribute("", "history", strings.Repeat("a long history ", 10))
+	nh.AddAttribute("r", "units", "m")
+	nh.AddVariable("b", []string{"x"}, []float64{})
+	nh.AddVariable("s", []string{"time"}, []int8{})
+	if err := f.EndDef(nh); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.EndDef(nh); err == nil {
+		t.Error("expected error on repeated EndDef")
+	}
+
+	g, err := Open(ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := g.Header.Check(); errs != nil {
+		t.Fatal(errs)
+	}
+	if g.Header.String() != nh.String() {
+		t.Errorf("header mismatch:\n%v\n%v", nh, g.Header)
+	}
+	if nr, err := readNumRecs(ff); nr != 3 || err != nil {
+		t.Error("numrecs:", nr, err)
+	}
+
+	a := make([]int32, 4)
+	if n, err := mustReader(t, g, "a", nil, nil).Read(a); n != 4 || a[3] != 3 {
+		t.Error("reading a:", a, err)
+	}
+	r := make([]int16, 12)
+	if n, err := mustReader(t, g, "r", nil, []int{2, 3}).Read(r); n != 12 || r[4] != 10 || r[11] != 23 {
+		t.Error("reading r:", r, err)
+	}
+	q := make([]float32, 3)
+	if n, err := mustReader(t, g, "q", nil, []int{2}).Read(q); n != 3 || q[0] != .5 || q[2] != 2.5 {
+		t.Error("reading q:", q, err)
+	}
+	b := make([]float64, 4)
+	if n, err := mustReader(t, g, "b", nil, nil).Read(b); n != 4 || b[0] != _DOUBLE.FillValue() {
+		t.Error("reading b:", b, err)
+	}
+	s := make([]int8, 3)
+	if n, err := mustReader(t, g, "s", nil, []int{2}).Read(s); n != 3 || s[2] != _BYTE.FillValue() {
+		t.Error("reading s:", s, err)
+	}
+}
+
+func TestRedefInPlace(t *testing.T) {
+	h := NewHeader([]string{"time", "x"}, []int{0, 4})
+	h.AddVariable("a", []string{"x"}, []int32{})
+	h.AddVariable("r", []string{"time", "x"}, []int16{})
+	h.DefineWithOptions(256, 0, 0)
+
+	ff, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(ff.Name())
+
+	f, err := Create(ff, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nh := f.Redef()
+	nh.AddAttribute("", "history", strings.Repeat("x", 200))
+	if err := f.EndDef(nh); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "r"} {
+		if h.varByName(v).begin != nh.varByName(v).begin {
+			t.Errorf("%s moved from %d to %d", v, h.varByName(v).begin, nh.varByName(v).begin)
+		}
+	}
+
+	nh = f.Redef()
+	nh.AddAttribute("", "comment", strings.Repeat("x", 200))
+	if err := f.EndDef(nh); err != nil {
+		t.Fatal(err)
+	}
+	if a := nh.varByName("a").begin; a < nh.size()+256 {
+		t.Errorf("relocated a to %d, expected at least %d", a, nh.size()+256)
+	}
+}
+
+func TestRedefGaps(t *testing.T) {
+	h := NewHeader([]string{"time", "x"}, []int{0, 300})
+	h.AddVariable("a", []string{"x"}, []int32{})
+	h.AddVariable("b", []string{"x"}, []int32{})
+	h.AddVariable("c", []string{"x"}, []int32{})
+	h.AddVariable("r", []string{"time"}, []int32{})
+	h.Define()
+	// as written by another program, with gaps after a and b.
+	h.vars[1].begin, h.vars[2].begin, h.vars[3].begin = 2000, 3200, 4800
+	if errs := h.Check(); errs != nil {
+		t.Fatal(errs)
+	}
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+	for i, v := range []string{"a", "b", "c"} {
+		x := make([]int32, 300)
+		for j := range x {
+			x[j] = int32(1000*i + j)
+		}
+		if n, _ := mustWriter(t, f, v, nil, nil).Write(x); n != 300 {
+			t.Fatal("writing", v, n)
+		}
+	}
+	if n, _ := mustWriter(t, f, "r", nil, []int{1}).Write([]int32{7, 8}); n != 2 {
+		t.Fatal("writing r", n)
+	}
+	if err := writeNumRecs(f.rw, h.version, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	nh := f.Redef()
+	nh.AddVariable("d", []string{"x"}, []int16{})
+	if err := f.EndDef(nh); err != nil {
+		t.Fatal(err)
+	}
+	if f.Header.varByName("c").begin >= 3200 {
+		t.Error("expected c to move down, begins at", f.Header.varByName("c").begin)
+	}
+
+	for i, v := range []string{"a", "b", "c"} {
+		x := make([]int32, 300)
+		if n, err := mustReader(t, f, v, nil, nil).Read(x); n != 300 {
+			t.Fatal("reading", v, n, err)
+		}
+		for j := range x {
+			if x[j] != int32(1000*i+j) {
+				t.Errorf("%s[%d] = %d, expected %d", v, j, x[j], 1000*i+j)
+				break
+			}
+		}
+	}
+	r := make([]int32, 2)
+	if n, _ := mustReader(t, f, "r", nil, []int{1}).Read(r); n != 2 || r[0] != 7 || r[1] != 8 {
+		t.Error("reading r:", n, r)
+	}
+}
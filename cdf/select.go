@@ -0,0 +1,171 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the selection of variable data by coordinate values.
+
+package cdf
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"time"
+)
+
+var (
+	errNoCoordinate   = errors.New("no coordinate variable for dimension")
+	errNotMonotonic   = errors.New("coordinate variable is not monotonic")
+	errEmptySelection = errors.New("no coordinate values in range")
+)
+
+// Bounds specifies how a Range selects coordinate values.
+type Bounds int
+
+const (
+	Inclusive Bounds = iota // select the values x with Lo <= x <= Hi
+	Exclusive               // select the values x with Lo < x < Hi
+	Nearest                 // select the values from the one nearest to Lo to the one nearest to Hi
+)
+
+// A Range selects the indices along dimension Dim for which the values of the
+// coordinate variable of Dim are between Lo and Hi.
+type Range struct {
+	Dim    string
+	Lo, Hi float64
+	Bounds Bounds
+}
+
+// coordinates reads all values of the coordinate variable of dimension dim, unpacked.
+func (f *File) coordinates(dim string) ([]float64, error) {
+	if !f.Header.IsCoordinateVariable(dim) {
+		return nil, errNoCoordinate
+	}
+	r, err := f.UnpackingReader(dim, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var xs []float64
+	buf := make([]float64, 1024)
+	for {
+		n, err := r.Read(buf)
+		xs = append(xs, buf[:n]...)
+		if err == io.EOF {
+			return xs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// IndexRange returns the first and last index along r.Dim selected by r.  The coordinate
+// variable of r.Dim must be strictly increasing or decreasing.  If Lo > Hi they are swapped.
+func (f *File) IndexRange(r Range) (first, last int, err error) {
+	xs, err := f.coordinates(r.Dim)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lo, hi := r.Lo, r.Hi
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+
+	// for decreasing coordinates, search the negated values
+	sign := 1.0
+	if len(xs) > 1 && xs[0] > xs[1] {
+		sign = -1
+		lo, hi = -hi, -lo
+	}
+	x := func(i int) float64 { return sign * xs[i] }
+	for i := 1; i < len(xs); i++ {
+		if !(x(i-1) < x(i)) {
+			return 0, 0, errNotMonotonic
+		}
+	}
+
+	n := len(xs)
+	switch r.Bounds {
+	case Inclusive:
+		first = sort.Search(n, func(i int) bool { return x(i) >= lo })
+		last = sort.Search(n, func(i int) bool { return x(i) > hi }) - 1
+	case Exclusive:
+		first = sort.Search(n, func(i int) bool { return x(i) > lo })
+		last = sort.Search(n, func(i int) bool { return x(i) >= hi }) - 1
+	case Nearest:
+		nearest := func(v float64) int {
+			i := sort.Search(n, func(i int) bool { return x(i) >= v })
+			if i == n || i > 0 && v-x(i-1) <= x(i)-v {
+				i--
+			}
+			return i
+		}
+		first, last = nearest(lo), nearest(hi)
+	}
+
+	if first > last || n == 0 {
+		return 0, 0, errEmptySelection
+	}
+	return first, last, nil
+}
+
+// TimeRange returns the Range along dimension dim between the times from and to, converted with
+// the TimeUnits of the coordinate variable of dim.
+func (f *File) TimeRange(dim string, from, to time.Time, bounds Bounds) (Range, error) {
+	u, err := f.Header.TimeUnits(dim)
+	if err != nil {
+		return Range{}, err
+	}
+	return Range{Dim: dim, Lo: u.Value(from), Hi: u.Value(to), Bounds: bounds}, nil
+}
+
+// Select creates a reader for the elements of variable v in the box selected by ranges, which
+// restrict dimensions of v by the values of their coordinate variables.  Dimensions without a
+// Range are not restricted, and Ranges for dimensions that v does not have are ignored.
+// Select also returns the start and count of the box along each dimension, as they would be
+// passed to StridedReader.
+func (f *File) Select(v string, ranges ...Range) (r Reader, start, count []int, err error) {
+	dims := f.Header.Dimensions(v)
+	if dims == nil {
+		return nil, nil, nil, ErrUnknownVariable
+	}
+	lengths := f.Header.Lengths(v)
+
+	start = make([]int, len(dims))
+	count = make([]int, len(dims))
+	for i := range dims {
+		count[i] = lengths[i]
+	}
+	if f.Header.IsRecordVariable(v) {
+		count[0] = -1
+	}
+
+	for _, rr := range ranges {
+		i := 0
+		for i < len(dims) && dims[i] != rr.Dim {
+			i++
+		}
+		if i == len(dims) {
+			continue
+		}
+		first, last, err := f.IndexRange(rr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		start[i], count[i] = first, last-first+1
+	}
+
+	r, err = f.StridedReader(v, start, count, nil)
+	return r, start, count, err
+}
@@ -0,0 +1,102 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelect(t *testing.T) {
+	h := NewHeader([]string{"time", "lat", "lon"}, []int{0, 5, 4})
+	h.AddVariable("time", []string{"time"}, []float64{})
+	h.AddAttribute("time", "units", "hours since 2000-01-01")
+	h.AddVariable("lat", []string{"lat"}, []float32{})
+	h.AddVariable("lon", []string{"lon"}, []int16{})
+	h.AddAttribute("lon", "scale_factor", []float32{10})
+	h.AddVariable("t", []string{"time", "lat", "lon"}, []int32{})
+	h.AddVariable("u", []string{"lat", "lon"}, []int32{})
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+
+	if n, _ := mustWriter(t, f, "lat", nil, nil).Write([]float32{50, 45, 40, 35, 30}); n != 5 {
+		t.Fatal("writing lat:", n)
+	}
+	if n, _ := mustWriter(t, f, "lon", nil, nil).Write([]int16{0, 1, 2, 3}); n != 4 {
+		t.Fatal("writing lon:", n)
+	}
+	tt := make([]int32, 3*5*4)
+	for i := range tt {
+		tt[i] = int32(i/20*100 + i/4%5*10 + i%4)
+	}
+	if n, _ := mustWriter(t, f, "t", nil, []int{2, 4, 3}).Write(tt); n != len(tt) {
+		t.Fatal("writing t:", n)
+	}
+	if n, _ := mustWriter(t, f, "time", nil, []int{2}).Write([]float64{0, 6, 12}); n != 3 {
+		t.Fatal("writing time:", n)
+	}
+
+	for _, tc := range []struct {
+		r           Range
+		first, last int
+		err         error
+	}{
+		{Range{"lat", 35, 45, Inclusive}, 1, 3, nil},
+		{Range{"lat", 45, 35, Inclusive}, 1, 3, nil},
+		{Range{"lat", 35, 45, Exclusive}, 2, 2, nil},
+		{Range{"lat", 36, 44, Nearest}, 1, 3, nil},
+		{Range{"lat", 47.5, 47.5, Nearest}, 0, 0, nil},
+		{Range{"lat", 60, 70, Nearest}, 0, 0, nil},
+		{Range{"lat", 41, 44, Inclusive}, 0, 0, errEmptySelection},
+		{Range{"lon", 5, 100, Inclusive}, 1, 3, nil},
+		{Range{"lon", 0, 10, Exclusive}, 0, 0, errEmptySelection},
+		{Range{"time", 6, 12, Inclusive}, 1, 2, nil},
+		{Range{"t", 6, 12, Inclusive}, 0, 0, errNoCoordinate},
+	} {
+		first, last, err := f.IndexRange(tc.r)
+		if first != tc.first || last != tc.last || err != tc.err {
+			t.Errorf("%v: got %d, %d, %v expected %d, %d, %v", tc.r, first, last, err, tc.first, tc.last, tc.err)
+		}
+	}
+
+	tr, err := f.TimeRange("time", time.Date(2000, 1, 1, 5, 0, 0, 0, time.UTC), time.Date(2000, 1, 1, 7, 0, 0, 0, time.UTC), Nearest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, start, count, err := f.Select("t", tr, Range{"lat", 40, 30, Inclusive}, Range{"lon", 20, 20, Inclusive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(start) != 3 || start[0] != 1 || start[1] != 2 || start[2] != 2 || count[0] != 1 || count[1] != 3 || count[2] != 1 {
+		t.Error("selection:", start, count)
+	}
+	buf := make([]int32, 4)
+	n, _ := r.Read(buf)
+	if n != 3 || buf[0] != 122 || buf[1] != 132 || buf[2] != 142 {
+		t.Error("reading selection:", buf[:n])
+	}
+
+	// no restriction on the record dimension
+	r, _, count, err = f.Select("t", Range{"lat", 50, 50, Inclusive}, Range{"lon", 0, 0, Inclusive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ = r.Read(buf)
+	if count[0] != -1 || n != 3 || buf[0] != 0 || buf[1] != 100 || buf[2] != 200 {
+		t.Error("reading selection:", count, buf[:n])
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the computation of summary statistics of variables.
+
+package cdf
+
+import (
+	"errors"
+	"math"
+)
+
+var errNotDimension = errors.New("not a dimension of the variable")
+
+// Stats summarizes the values of a variable.  Min, Max, Mean and StdDev, the population
+// standard deviation, are over the Valid values and are NaN if there are none.
+type Stats struct {
+	Valid, Missing         int64
+	Min, Max, Mean, StdDev float64
+
+	m2 float64 // sum of squared differences from the mean
+}
+
+// add adds x, updating the mean and m2 as per Welford's algorithm.
+func (s *Stats) add(x float64) {
+	if s.Valid == 0 || x < s.Min {
+		s.Min = x
+	}
+	if s.Valid == 0 || x > s.Max {
+		s.Max = x
+	}
+	s.Valid++
+	d := x - s.Mean
+	s.Mean += d / float64(s.Valid)
+	s.m2 += d * (x - s.Mean)
+}
+
+func (s *Stats) finish() {
+	if s.Valid == 0 {
+		s.Min, s.Max, s.Mean, s.StdDev = math.NaN(), math.NaN(), math.NaN(), math.NaN()
+		return
+	}
+	s.StdDev = math.Sqrt(s.m2 / float64(s.Valid))
+}
+
+// Stats computes the statistics of the unpacked values of the numeric variable v, excluding
+// the values that are missing according to its Mask.  The values are read in one pass
+// through a MaskedReader, in chunks of a fixed size.  For a record variable, the records
+// up to f.NumRecs are included.
+func (f *File) Stats(v string) (*Stats, error) {
+	s, err := f.stats(v, -1)
+	if err != nil {
+		return nil, err
+	}
+	return &s[0], nil
+}
+
+// StatsAlong is like Stats, but returns separate statistics for every index of dimension dim
+// of v.  For the record dimension these are the statistics per record.
+func (f *File) StatsAlong(v, dim string) ([]Stats, error) {
+	if f.Header.varByName(v) == nil {
+		return nil, ErrUnknownVariable
+	}
+	d := -1
+	for i, dd := range f.Header.Dimensions(v) {
+		if dd == dim {
+			d = i
+		}
+	}
+	if d < 0 {
+		return nil, errNotDimension
+	}
+	return f.stats(v, d)
+}
+
+// stats computes the statistics of v along its d'th dimension, or of all of v if d < 0.
+func (f *File) stats(v string, d int) ([]Stats, error) {
+	vv := f.Header.varByName(v)
+	if vv == nil {
+		return nil, ErrUnknownVariable
+	}
+	if vv.dtype == _CHAR {
+		return nil, errNotNumeric
+	}
+	lengths := append([]int(nil), vv.lengths...)
+	if vv.isRecordVariable() {
+		nr, err := f.recordCount()
+		if err != nil {
+			return nil, err
+		}
+		lengths[0] = int(nr)
+	}
+	end := make([]int, len(lengths))
+	total := int64(1)
+	for i, l := range lengths {
+		end[i] = l - 1
+		total *= int64(l)
+	}
+
+	// element i is at index (i / inner) % n along d.
+	n, inner := int64(1), int64(1)
+	if d >= 0 {
+		n = int64(lengths[d])
+		for _, l := range lengths[d+1:] {
+			inner *= int64(l)
+		}
+	}
+	s := make([]Stats, n)
+
+	if total > 0 {
+		r, err := f.MaskedReader(v, nil, end)
+		if err != nil {
+			return nil, err
+		}
+		const chunk = 1 << 14
+		vals, valid := make([]float64, chunk), make([]bool, chunk)
+		for pos := int64(0); pos < total; pos += chunk {
+			m := chunk
+			if total-pos < chunk {
+				m = int(total - pos)
+			}
+			if k, err := r.Read(vals[:m], valid[:m]); k < m {
+				return nil, noEOF(err)
+			}
+			for i, x := range vals[:m] {
+				st := &s[(pos+int64(i))/inner%n]
+				if valid[i] {
+					st.add(x)
+				} else {
+					st.Missing++
+				}
+			}
+		}
+	}
+
+	for i := range s {
+		s[i].finish()
+	}
+	return s, nil
+}
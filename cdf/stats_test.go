@@ -0,0 +1,67 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	h := NewHeader([]string{"time", "x"}, []int{0, 3})
+	h.AddVariable("r", []string{"time", "x"}, []int16{})
+	h.AddAttribute("r", "scale_factor", []float32{2})
+	h.AddAttribute("r", "valid_range", []int16{0, 100})
+	h.AddVariable("c", []string{"x"}, "")
+	h.Define()
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+	a, _ := f.Appender()
+	for _, r := range [][]int16{{1, 2, 3}, {-32767, 4, 200}, {-1, -1, -1}} {
+		if _, err := a.Append(map[string]interface{}{"r": r}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := f.Stats("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// valid are 2, 4, 6, 8
+	if s.Valid != 4 || s.Missing != 5 || s.Min != 2 || s.Max != 8 || s.Mean != 5 || math.Abs(s.StdDev-math.Sqrt(5)) > 1e-12 {
+		t.Errorf("stats: %+v", s)
+	}
+
+	st, err := f.StatsAlong("r", "time")
+	if err != nil || len(st) != 3 {
+		t.Fatal("stats along time:", st, err)
+	}
+	if st[0].Valid != 3 || st[0].Mean != 4 || st[1].Valid != 1 || st[1].Min != 8 || st[1].StdDev != 0 || st[2].Valid != 0 || !math.IsNaN(st[2].Mean) {
+		t.Errorf("stats along time: %+v", st)
+	}
+
+	st, err = f.StatsAlong("r", "x")
+	if err != nil || len(st) != 3 || st[0].Valid != 1 || st[0].Missing != 2 || st[1].Mean != 6 || st[2].Max != 6 {
+		t.Errorf("stats along x: %+v %v", st, err)
+	}
+
+	if _, err := f.StatsAlong("r", "y"); err != errNotDimension {
+		t.Error("expected errNotDimension, got", err)
+	}
+	if _, err := f.Stats("c"); err != errNotNumeric {
+		t.Error("expected errNotNumeric, got", err)
+	}
+}
@@ -17,16 +17,16 @@
 package cdf
 
 import (
-	"encoding/binary"
 	"errors"
 	"io"
+	"sync/atomic"
 )
 
 // A reader is an object that can read values from a CDF file.
 type Reader interface {
 	// Read reads len(values.([]T)) elements from the underlying file into values.
 	//
-	// Values must be a slice of int{8,16,32} or float{32,64},
+	// Values must be a slice of int{8,16,32,64}, uint{8,16,32,64} or float{32,64},
 	// corresponding to the type of the variable, with one
 	// exception: A variable of NetCDF type CHAR must be read into
 	// a []byte.  Read returns the number of elements actually
@@ -43,7 +43,7 @@ type Reader interface {
 type Writer interface {
 	// Write writes len(values.([]T)) elements from values to the underlying file.
 	//
-	// Values must be a slice of int{8,16,32} or float{32,64} or a
+	// Values must be a slice of int{8,16,32,64}, uint{8,16,32,64} or float{32,64} or a
 	// string, according to the type of the variable.  if n <
 	// len(values.([]T)), err will be set.
 	Write(values interface{}) (n int, err error)
@@ -52,31 +52,53 @@ type Writer interface {
 // Create a reader that starts at the corner begin, ends at end.  If begin is nil,
 // it defaults to the origin (0, 0, ...).  If end is nil, it defaults
 // to the f.Header.Lengths(v).
-func (f *File) Reader(v string, begin, end []int) Reader { return f.strider(v, begin, end) }
+// The reader returns all elements between begin and end in the linearised order of
+// the variable, not the box they span; use StridedReader for that.
+//
+// If end is nil and v is a record variable, the reader ends at the last record as given by f.NumRecs,
+// unless the file is in STREAMING mode, in which case reading proceeds until EOF.
+//
+// Reader returns ErrUnknownVariable if v does not name a variable, and ErrBadIndex
+// if begin or end do not have an index for every dimension of v.
+func (f *File) Reader(v string, begin, end []int) (Reader, error) {
+	vv := f.Header.varByName(v)
+	if vv == nil {
+		return nil, ErrUnknownVariable
+	}
+	s, err := f.linearStrider(vv, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	if end == nil {
+		f.limitToRecords(s, vv)
+	}
+	return typedStrider(s, vv.dtype), nil
+}
 
 // Create a writer that starts at the corner begin, ends at end.  If begin is nil,
 // it defaults to the origin (0, 0, ...).  If end is nil and the variable is
 // a record variable, writing can proceed past EOF and the underlying file will be extended.
-func (f *File) Writer(v string, begin, end []int) Writer { return f.strider(v, begin, end) }
-
-func (f *File) strider(v string, begin, end []int) interface {
-	Reader
-	Writer
-} {
+// Writer returns the same errors as Reader.
+func (f *File) Writer(v string, begin, end []int) (Writer, error) {
 	vv := f.Header.varByName(v)
 	if vv == nil {
-		return nil
+		return nil, ErrUnknownVariable
 	}
-
-	if begin != nil && len(begin) != len(vv.dim) {
-		panic("invalid begin index vector")
+	s, err := f.linearStrider(vv, begin, end)
+	if err != nil {
+		return nil, err
 	}
+	return typedStrider(s, vv.dtype), nil
+}
+
+// linearStrider returns the untyped strider over the elements of vv between the corners begin and end.
+func (f *File) linearStrider(vv *variable, begin, end []int) (*strider, error) {
 
-	if end != nil && len(end) != len(vv.dim) {
-		panic("invalid end index vector")
+	if begin != nil && len(begin) != len(vv.dim) || end != nil && len(end) != len(vv.dim) {
+		return nil, ErrBadIndex
 	}
 
-	var b, e, sz, sk int64
+	var b, e int64
 
 	if begin != nil {
 		b = vv.offsetOf(begin)
@@ -95,119 +117,320 @@ func (f *File) strider(v string, begin, end []int) interface {
 	}
 
 	if vv.isRecordVariable() {
-		sz = vv.strides[0] // vsize
-		sk = vv.strides[1] // slabsize
-	} else {
-		sz = e - b
-		sk = e - b
+		// stripes of vsize every slabsize bytes, starting inside the record of begin
+		rec := vv.begin
+		if begin != nil {
+			rec += int64(begin[0]) * vv.strides[1]
+		}
+		r := newStrider(f.rw, rec, e, vv.strides[0], []int64{vv.strides[1]}, []int64{-1})
+		r.rpos = b - rec
+		r.checkEnd()
+		return r, nil
+	}
+	return newStrider(f.rw, b, e, e-b, nil, nil), nil
+}
+
+// StridedReader creates a reader for the elements of variable v in the N-dimensional box
+// that starts at the corner start, and extends count[i] elements along dimension i,
+// taking every stride[i]'th element, like nc_get_vars.  The elements are read in
+// row-major order.
+//
+// If start is nil it defaults to the origin.  If stride is nil it defaults to all 1's.  If count is nil
+// it defaults to the rest of each dimension; for the record dimension this means reading proceeds until
+// the last record as given by f.NumRecs, or until EOF if the file is in STREAMING mode.
+// A count of -1 for the record dimension means the same.
+func (f *File) StridedReader(v string, start, count, stride []int) (Reader, error) {
+	return f.boxStrider(v, start, count, stride, atomic.LoadInt64(&f.numrecs))
+}
+
+// StridedWriter creates a writer for the elements of variable v in the N-dimensional box
+// defined by start, count and stride as for StridedReader, like nc_put_vars.
+// A count of -1 for the record dimension means writing can proceed past EOF and
+// the underlying file will be extended.
+func (f *File) StridedWriter(v string, start, count, stride []int) (Writer, error) {
+	return f.boxStrider(v, start, count, stride, -1)
+}
+
+// boxStrider returns the strider for StridedReader and StridedWriter.  If nrec >= 0, an unbounded
+// count for the record dimension is limited to the first nrec records.
+func (f *File) boxStrider(v string, start, count, stride []int, nrec int64) (interface {
+	Reader
+	Writer
+}, error) {
+	s, vv, err := f.rawBoxStrider(v, start, count, stride, nrec)
+	if err != nil {
+		return nil, err
+	}
+	return typedStrider(s, vv.dtype), nil
+}
+
+// rawBoxStrider is like boxStrider, but returns the untyped strider and the variable.
+func (f *File) rawBoxStrider(v string, start, count, stride []int, nrec int64) (*strider, *variable, error) {
+	vv := f.Header.varByName(v)
+	if vv == nil {
+		return nil, nil, ErrUnknownVariable
+	}
+
+	n := len(vv.dim)
+	if start != nil && len(start) != n || count != nil && len(count) != n || stride != nil && len(stride) != n {
+		return nil, nil, ErrBadIndex
+	}
+
+	b := vv.begin
+	cnt := make([]int64, n)
+	stp := make([]int64, n)
+	for i := 0; i < n; i++ {
+		st, sd := 0, 1
+		if start != nil {
+			st = start[i]
+		}
+		if stride != nil {
+			sd = stride[i]
+		}
+		c := vv.lengths[i] - st
+		if count != nil {
+			c = count[i]
+		}
+		if st < 0 || sd < 1 {
+			return nil, nil, ErrBadIndex
+		}
+		if i == 0 && vv.isRecordVariable() {
+			if count == nil || c < 0 {
+				c = -1
+				if nrec >= 0 {
+					c = 0
+					if int64(st) < nrec {
+						c = int((nrec - int64(st) + int64(sd) - 1) / int64(sd))
+					}
+				}
+			}
+		} else if c < 0 || c > 0 && st+(c-1)*sd >= vv.lengths[i] {
+			return nil, nil, ErrBadIndex
+		}
+		b += int64(st) * vv.strides[i+1]
+		cnt[i] = int64(c)
+		stp[i] = int64(sd) * vv.strides[i+1]
+	}
+
+	// merge the innermost dimensions as long as their elements are adjacent.
+	size := int64(vv.dtype.storageSize())
+	for n > 0 && cnt[n-1] >= 0 && stp[n-1] == size {
+		n--
+		size *= cnt[n]
 	}
 
-	switch vv.dtype {
+	return newStrider(f.rw, b, 0, size, stp[:n], cnt[:n]), vv, nil
+}
+
+func typedStrider(s *strider, dtype datatype) interface {
+	Reader
+	Writer
+} {
+	switch dtype {
 	case _BYTE, _CHAR:
-		return &int8strider{f.rw, b, e, sz, sk, b}
+		return (*int8strider)(s)
 	case _SHORT:
-		return &int16strider{f.rw, b, e, sz, sk, b}
+		return (*int16strider)(s)
 	case _INT:
-		return &int32strider{f.rw, b, e, sz, sk, b}
+		return (*int32strider)(s)
 	case _FLOAT:
-		return &float32strider{f.rw, b, e, sz, sk, b}
+		return (*float32strider)(s)
 	case _DOUBLE:
-		return &float64strider{f.rw, b, e, sz, sk, b}
+		return (*float64strider)(s)
+	case _UBYTE:
+		return (*uint8strider)(s)
+	case _USHORT:
+		return (*uint16strider)(s)
+	case _UINT:
+		return (*uint32strider)(s)
+	case _INT64:
+		return (*int64strider)(s)
+	case _UINT64:
+		return (*uint64strider)(s)
 	}
 	panic("invalid variable data type")
 }
 
+// A strider reads or writes a sequence of runs of size contiguous bytes.
+// The runs start at begin + sum(idx[i] * steps[i]) for all 0 <= idx[i] < counts[i],
+// in row-major order, where a count of -1 means unbounded.  If end > 0, the
+// sequence ends at offset end.
 type strider struct {
-	rw                 ReaderWriterAt
-	begin, end         int64
-	stripesize, stride int64
-	curr               int64
+	rw     ReaderWriterAt
+	begin  int64
+	end    int64
+	size   int64
+	steps  []int64
+	counts []int64
+
+	idx  []int64 // index of the current run
+	run  int64   // offset of the current run
+	rpos int64   // position within the current run
+	done int64   // number of bytes transferred
+	eof  bool    // all runs transferred
+	buf  []byte  // scratch buffer for writeElems
 }
 
-func (r *strider) relOffs(elemsz int) int64 {
-	s := (r.curr - r.begin) / r.stride // stripe number
-	e := (r.curr - r.begin) % r.stride // offset within stripe
-	nn := (s * r.stripesize) + e
-	nn /= int64(elemsz)
-	return nn
+func newStrider(rw ReaderWriterAt, begin, end, size int64, steps, counts []int64) *strider {
+	r := &strider{rw: rw, begin: begin, end: end, size: size, steps: steps, counts: counts,
+		idx: make([]int64, len(steps)), run: begin}
+	r.eof = size <= 0
+	for _, c := range counts {
+		if c == 0 {
+			r.eof = true
+		}
+	}
+	r.checkEnd()
+	return r
 }
 
-func (r *strider) Read(p []byte) (n int, err error) {
-	se := (r.curr - r.begin) / r.stride // stripe number
-	se = r.begin + se*r.stride          // stripe begin
-	se += r.stripesize                  // stripe end
-
-	for len(p) > 0 {
-		nn := int64(len(p))
-		if r.curr+nn > se {
-			nn = se - r.curr
-		}
-		if r.end > 0 && r.curr+nn > r.end {
-			nn = r.end - r.curr
-		}
+func (r *strider) checkEnd() {
+	if r.end > 0 && r.run+r.rpos >= r.end {
+		r.eof = true
+	}
+}
 
-		nr, err := r.rw.ReadAt(p[:nn], r.curr)
-		r.curr += int64(nr)
-		n += nr
-		p = p[nr:]
-		if r.curr == se {
-			r.curr += r.stride - r.stripesize
-			se += r.stride
-		}
-		if err != nil {
-			return n, err
-		}
-		if r.curr >= r.end {
-			return n, io.EOF
+// nextRun advances to the start of the next run, or sets eof.
+func (r *strider) nextRun() {
+	r.rpos = 0
+	for i := len(r.idx) - 1; i >= 0; i-- {
+		r.idx[i]++
+		r.run += r.steps[i]
+		if r.counts[i] < 0 || r.idx[i] < r.counts[i] {
+			return
 		}
+		r.run -= r.idx[i] * r.steps[i]
+		r.idx[i] = 0
 	}
-
-	return n, nil
+	r.eof = true
 }
 
-func (r *strider) Write(p []byte) (n int, err error) {
-	se := (r.curr - r.begin) / r.stride // stripe number
-	se = r.begin + se*r.stride          // stripe begin
-	se += r.stripesize                  // stripe end
+// transfer calls at for consecutive pieces of p and the corresponding offsets.
+// Like the underlying storage, it returns io.EOF as soon as the end of the sequence is reached.
+func (r *strider) transfer(p []byte, at func([]byte, int64) (int, error)) (n int, err error) {
+	return r.walk(len(p), func(i int, off int64, k int) (int, error) { return at(p[i:i+k], off) })
+}
 
-	for len(p) > 0 {
-		nn := int64(len(p))
-		if r.curr+nn > se {
-			nn = se - r.curr
+// walk advances over the next n bytes of the sequence, calling fn for every piece of k contiguous bytes
+// at offset off, the i'th byte of the n, until fn returns an error or transfers fewer than k bytes.
+// It returns the number of bytes transferred, and io.EOF as soon as the end of the sequence is reached.
+func (r *strider) walk(n int, fn func(i int, off int64, k int) (int, error)) (done int, err error) {
+	for done < n && !r.eof {
+		k := r.size - r.rpos
+		if r.end > 0 && r.run+r.rpos+k > r.end {
+			k = r.end - r.run - r.rpos
 		}
-		if r.end > 0 && r.curr+nn > r.end {
-			nn = r.end - r.curr
+		if k > int64(n-done) {
+			k = int64(n - done)
 		}
 
-		nr, err := r.rw.WriteAt(p[:nn], r.curr)
-		r.curr += int64(nr)
-		n += nr
-		p = p[nr:]
-		if r.curr == se {
-			r.curr += r.stride - r.stripesize
-			se += r.stride
+		nn, err := fn(done, r.run+r.rpos, int(k))
+		done += nn
+		r.done += int64(nn)
+		r.rpos += int64(nn)
+		if r.rpos == r.size {
+			r.nextRun()
 		}
+		r.checkEnd()
 		if err != nil {
-			return n, err
-		}
-		if r.end > 0 && r.curr >= r.end {
-			return n, io.EOF
+			return done, err
 		}
 	}
 
-	return n, nil
+	if r.eof {
+		return done, io.EOF
+	}
+	return done, nil
 }
 
+func (r *strider) Read(p []byte) (n int, err error)  { return r.transfer(p, r.rw.ReadAt) }
+func (r *strider) Write(p []byte) (n int, err error) { return r.transfer(p, r.rw.WriteAt) }
+
+// readElems reads as many elements as possible into values and decodes them.
+// If fewer than len(values) could be read, err is io.EOF or the error from the underlying storage.
 func (r *strider) readElems(elemsz int, values interface{}) (int, error) {
-	nn := r.relOffs(elemsz)
-	err := binary.Read(r, binary.BigEndian, values)
-	return int(r.relOffs(elemsz) - nn), err
+	return r.readBytes(elemsz, elemBytes(values))
+}
+
+// readBytes is readElems for the memory buf of the values.  The elements are read into buf and
+// swapped in place, or copied from the mapping if the storage is mapped into memory.
+// A trailing partial element is zeroed.
+func (r *strider) readBytes(elemsz int, buf []byte) (int, error) {
+	var n int
+	var err error
+	var data []byte
+	if m, ok := r.rw.(mapper); ok {
+		data = m.mapped()
+	}
+	if data != nil {
+		n, err = r.readMapped(data, buf)
+	} else {
+		n, err = io.ReadFull(r, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+	}
+	k := n / elemsz * elemsz
+	clear(buf[k:n])
+	fromBigEndian(buf[:k], elemsz)
+	return n / elemsz, err
 }
 
+// truncate returns values[:n] for a slice values of any of the supported types.
+func truncate(values interface{}, n int) interface{} {
+	switch vv := values.(type) {
+	case []int8:
+		return vv[:n]
+	case []int16:
+		return vv[:n]
+	case []int32:
+		return vv[:n]
+	case []float32:
+		return vv[:n]
+	case []float64:
+		return vv[:n]
+	case []uint8:
+		return vv[:n]
+	case []uint16:
+		return vv[:n]
+	case []uint32:
+		return vv[:n]
+	case []int64:
+		return vv[:n]
+	case []uint64:
+		return vv[:n]
+	}
+	return values
+}
+
+// writeElems encodes values and writes them.
 func (r *strider) writeElems(elemsz int, values interface{}) (int, error) {
-	nn := r.relOffs(elemsz)
-	err := binary.Write(r, binary.BigEndian, values)
-	return int(r.relOffs(elemsz) - nn), err
+	return r.writeBytes(elemsz, elemBytes(values))
+}
+
+// writeBytes is writeElems for the memory src of the values.  The elements are encoded in chunks
+// of the strider's scratch buffer, bytes are written directly.
+func (r *strider) writeBytes(elemsz int, src []byte) (int, error) {
+	const chunk = 1 << 16 // a multiple of every element size
+	nn := r.done
+	for len(src) > 0 {
+		p := src
+		if elemsz > 1 && !nativeBigEndian {
+			if len(p) > chunk {
+				p = p[:chunk]
+			}
+			if r.buf == nil {
+				r.buf = make([]byte, chunk)
+			}
+			toBigEndian(r.buf, p, elemsz)
+			p = r.buf[:len(p)]
+		}
+		if _, err := r.Write(p); err != nil {
+			return int((r.done - nn) / int64(elemsz)), err
+		}
+		src = src[len(p):]
+	}
+	return int((r.done - nn) / int64(elemsz)), nil
 }
 
 var badValueType = errors.New("value type mismatch")
@@ -217,6 +440,11 @@ type int16strider strider
 type int32strider strider
 type float32strider strider
 type float64strider strider
+type uint8strider strider
+type uint16strider strider
+type uint32strider strider
+type int64strider strider
+type uint64strider strider
 
 func (r *int8strider) Read(values interface{}) (n int, err error) {
 	if _, ok := values.([]int8); !ok {
@@ -253,11 +481,48 @@ func (r *float64strider) Read(values interface{}) (n int, err error) {
 	return (*strider)(r).readElems(8, values)
 }
 
+func (r *uint8strider) Read(values interface{}) (n int, err error) {
+	if _, ok := values.([]uint8); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).readElems(1, values)
+}
+
+func (r *uint16strider) Read(values interface{}) (n int, err error) {
+	if _, ok := values.([]uint16); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).readElems(2, values)
+}
+
+func (r *uint32strider) Read(values interface{}) (n int, err error) {
+	if _, ok := values.([]uint32); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).readElems(4, values)
+}
+
+func (r *int64strider) Read(values interface{}) (n int, err error) {
+	if _, ok := values.([]int64); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).readElems(8, values)
+}
+
+func (r *uint64strider) Read(values interface{}) (n int, err error) {
+	if _, ok := values.([]uint64); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).readElems(8, values)
+}
+
 func (r *int8strider) Write(values interface{}) (n int, err error) {
 	if _, ok := values.([]int8); !ok {
-		if _, ok := values.(string); !ok {
+		s, ok := values.(string)
+		if !ok {
 			return 0, badValueType
 		}
+		values = []byte(s) // writeElems does not encode strings
 	}
 	return (*strider)(r).writeElems(1, values)
 }
@@ -290,36 +555,106 @@ func (r *float64strider) Write(values interface{}) (n int, err error) {
 	return (*strider)(r).writeElems(8, values)
 }
 
+func (r *uint8strider) Write(values interface{}) (n int, err error) {
+	if _, ok := values.([]uint8); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).writeElems(1, values)
+}
+
+func (r *uint16strider) Write(values interface{}) (n int, err error) {
+	if _, ok := values.([]uint16); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).writeElems(2, values)
+}
+
+func (r *uint32strider) Write(values interface{}) (n int, err error) {
+	if _, ok := values.([]uint32); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).writeElems(4, values)
+}
+
+func (r *int64strider) Write(values interface{}) (n int, err error) {
+	if _, ok := values.([]int64); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).writeElems(8, values)
+}
+
+func (r *uint64strider) Write(values interface{}) (n int, err error) {
+	if _, ok := values.([]uint64); !ok {
+		return 0, badValueType
+	}
+	return (*strider)(r).writeElems(8, values)
+}
+
 func (r *int8strider) Zero(n int) interface{} {
 	if n < 0 {
-		n = int(r.stripesize)
+		n = int(r.size)
 	}
 	return make([]int8, n)
 }
 
 func (r *int16strider) Zero(n int) interface{} {
 	if n < 0 {
-		n = int(r.stripesize / 2)
+		n = int(r.size / 2)
 	}
 	return make([]int16, n)
 }
 
 func (r *int32strider) Zero(n int) interface{} {
 	if n < 0 {
-		n = int(r.stripesize / 4)
+		n = int(r.size / 4)
 	}
 	return make([]int32, n)
 }
 
 func (r *float32strider) Zero(n int) interface{} {
 	if n < 0 {
-		n = int(r.stripesize / 4)
+		n = int(r.size / 4)
 	}
 	return make([]float32, n)
 }
 func (r *float64strider) Zero(n int) interface{} {
 	if n < 0 {
-		n = int(r.stripesize / 8)
+		n = int(r.size / 8)
 	}
 	return make([]float64, n)
 }
+
+func (r *uint8strider) Zero(n int) interface{} {
+	if n < 0 {
+		n = int(r.size)
+	}
+	return make([]uint8, n)
+}
+
+func (r *uint16strider) Zero(n int) interface{} {
+	if n < 0 {
+		n = int(r.size / 2)
+	}
+	return make([]uint16, n)
+}
+
+func (r *uint32strider) Zero(n int) interface{} {
+	if n < 0 {
+		n = int(r.size / 4)
+	}
+	return make([]uint32, n)
+}
+
+func (r *int64strider) Zero(n int) interface{} {
+	if n < 0 {
+		n = int(r.size / 8)
+	}
+	return make([]int64, n)
+}
+
+func (r *uint64strider) Zero(n int) interface{} {
+	if n < 0 {
+		n = int(r.size / 8)
+	}
+	return make([]uint64, n)
+}
@@ -0,0 +1,286 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the export of variables as tables.
+
+package cdf
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errTableFormat = errors.New("invalid table format")
+
+// A TableFormat is one of the formats written by WriteTable.
+type TableFormat int
+
+const (
+	CSV  TableFormat = iota // comma separated values, with a header line
+	TSV                     // tab separated values, with a header line
+	JSON                    // newline delimited JSON, one object per row
+)
+
+// WriteTable writes variable v to w in long form: one row per element, with a column for every
+// dimension of v, except for the dimension of a coordinate variable itself, and a last column,
+// named v, for the value.  The dimension columns hold the values of the coordinate variables,
+// formatted as RFC 3339 times if they have CF time units, or else the indices.
+// Numeric values are unpacked, and missing values are written as empty fields or null.  For CHAR
+// variables of rank 2 or more, the innermost dimension is taken as the length of a string,
+// and the rows are the strings, without trailing NULs.
+//
+// The coordinate variables are read first, the values of v are read in chunks of a fixed size.
+// For a record variable, the records up to f.NumRecs are written.
+func (f *File) WriteTable(w io.Writer, v string, format TableFormat) error {
+	h := f.Header
+	vv := h.varByName(v)
+	if vv == nil {
+		return ErrUnknownVariable
+	}
+	if format < CSV || format > JSON {
+		return errTableFormat
+	}
+	dims := h.Dimensions(v)
+	lengths := append([]int(nil), vv.lengths...)
+	if vv.isRecordVariable() {
+		nr, err := f.recordCount()
+		if err != nil {
+			return err
+		}
+		lengths[0] = int(nr)
+	}
+	strlen := 1
+	if vv.dtype == _CHAR && len(dims) > 1 {
+		strlen = lengths[len(lengths)-1]
+		dims, lengths = dims[:len(dims)-1], lengths[:len(lengths)-1]
+	}
+	total := int64(1)
+	for _, l := range lengths {
+		total *= int64(l)
+	}
+
+	// the names of the columns, whether they are numeric, and the text of the coordinates,
+	// nil for the columns of indices.
+	var names []string
+	var isNum []bool
+	coords := make([][]string, len(dims))
+	for i, d := range dims {
+		if d != v {
+			names, isNum = append(names, d), append(isNum, true)
+		}
+		if !h.IsCoordinateVariable(d) || h.varByName(d).dtype == _CHAR {
+			continue
+		}
+		xs, err := f.coordinates(d)
+		if err != nil {
+			return err
+		}
+		u, err := h.TimeUnits(d)
+		if err != nil {
+			u = nil
+		}
+		if d != v {
+			isNum[len(isNum)-1] = u == nil
+		}
+		coords[i] = make([]string, lengths[i])
+		for j := range coords[i] {
+			switch {
+			case j >= len(xs) || math.IsNaN(xs[j]):
+			case u != nil:
+				coords[i][j] = u.Time(xs[j]).Format(time.RFC3339Nano)
+			default:
+				coords[i][j] = formatFloat(xs[j], h.varByName(d).dtype)
+			}
+		}
+	}
+
+	names, isNum = append(names, v), append(isNum, vv.dtype != _CHAR)
+	tw := newTableWriter(w, format, names)
+	if err := tw.header(); err != nil {
+		return err
+	}
+
+	var next func(values []string, valid []bool) error
+	if vv.dtype == _CHAR {
+		r, err := f.Reader(v, nil, nil)
+		if err != nil {
+			return err
+		}
+		buf := make([]int8, strlen)
+		next = func(values []string, valid []bool) error {
+			for i := range values {
+				if n, err := r.Read(buf); n < len(buf) {
+					return noEOF(err)
+				}
+				b := make([]byte, len(buf))
+				for j, c := range buf {
+					b[j] = byte(c)
+				}
+				values[i], valid[i] = strings.TrimRight(string(b), "\x00"), true
+			}
+			return nil
+		}
+	} else {
+		end := make([]int, len(lengths))
+		for i, l := range lengths {
+			end[i] = l - 1
+		}
+		if total == 0 {
+			return tw.flush()
+		}
+		r, err := f.MaskedReader(v, nil, end)
+		if err != nil {
+			return err
+		}
+		var xs []float64
+		next = func(values []string, valid []bool) error {
+			if len(xs) < len(values) {
+				xs = make([]float64, len(values))
+			}
+			if n, err := r.Read(xs[:len(values)], valid); n < len(values) {
+				return noEOF(err)
+			}
+			for i, x := range xs[:len(values)] {
+				if valid[i] {
+					values[i] = formatFloat(x, vv.dtype)
+				}
+			}
+			return nil
+		}
+	}
+
+	const chunk = 1 << 12
+	values, valid := make([]string, chunk), make([]bool, chunk)
+	idx := make([]int, len(lengths))
+	row := make([]string, 0, len(names))
+	for pos := int64(0); pos < total; pos += chunk {
+		m := chunk
+		if total-pos < chunk {
+			m = int(total - pos)
+		}
+		if err := next(values[:m], valid[:m]); err != nil {
+			return err
+		}
+		for k := range values[:m] {
+			row = row[:0]
+			for i, j := range idx {
+				switch {
+				case dims[i] == v:
+				case coords[i] != nil:
+					row = append(row, coords[i][j])
+				default:
+					row = append(row, strconv.Itoa(j))
+				}
+			}
+			if valid[k] {
+				row = append(row, values[k])
+			} else {
+				row = append(row, "")
+			}
+			if err := tw.row(row, isNum); err != nil {
+				return err
+			}
+			// advance idx in row-major order
+			for i := len(idx) - 1; i >= 0; i-- {
+				if idx[i]++; idx[i] < lengths[i] {
+					break
+				}
+				idx[i] = 0
+			}
+		}
+	}
+	return tw.flush()
+}
+
+// formatFloat formats x in the shortest form that reads back as the same value of the data type.
+func formatFloat(x float64, dtype datatype) string {
+	if dtype == _FLOAT {
+		return strconv.FormatFloat(x, 'g', -1, 32)
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// A tableWriter writes the rows of a table in one of the TableFormats.
+type tableWriter struct {
+	names []string
+	keys  [][]byte // the JSON encoded names
+	csv   *csv.Writer
+	w     *bufio.Writer
+}
+
+func newTableWriter(w io.Writer, format TableFormat, names []string) *tableWriter {
+	t := &tableWriter{names: names, w: bufio.NewWriter(w)}
+	for _, n := range names {
+		b, _ := json.Marshal(n)
+		t.keys = append(t.keys, append(b, ':'))
+	}
+	if format != JSON {
+		t.csv = csv.NewWriter(t.w)
+		if format == TSV {
+			t.csv.Comma = '\t'
+		}
+	}
+	return t
+}
+
+func (t *tableWriter) header() error {
+	if t.csv != nil {
+		return t.csv.Write(t.names)
+	}
+	return nil
+}
+
+// row writes a row of fields.  In JSON, numeric fields are written as numbers, or null if they
+// are empty or not finite.
+func (t *tableWriter) row(fields []string, isNum []bool) error {
+	if t.csv != nil {
+		return t.csv.Write(fields)
+	}
+	t.w.WriteByte('{')
+	for i, s := range fields {
+		if i > 0 {
+			t.w.WriteByte(',')
+		}
+		t.w.Write(t.keys[i])
+		switch {
+		case isNum[i] && (s == "" || s == "NaN" || strings.HasSuffix(s, "Inf")):
+			t.w.WriteString("null")
+		case isNum[i]:
+			t.w.WriteString(s)
+		default:
+			b, _ := json.Marshal(s)
+			t.w.Write(b)
+		}
+	}
+	t.w.WriteByte('}')
+	_, err := t.w.WriteString("\n")
+	return err
+}
+
+func (t *tableWriter) flush() error {
+	if t.csv != nil {
+		t.csv.Flush()
+		if err := t.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return t.w.Flush()
+}
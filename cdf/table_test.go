@@ -0,0 +1,85 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTable(t *testing.T) {
+	h := NewHeader([]string{"time", "lat", "strlen"}, []int{0, 2, 3})
+	h.AddVariable("time", []string{"time"}, []float64{})
+	h.AddAttribute("time", "units", "hours since 2000-01-01 00:00:00")
+	h.AddVariable("lat", []string{"lat"}, []float32{})
+	h.AddVariable("t", []string{"time", "lat"}, []int16{})
+	h.AddAttribute("t", "_FillValue", []int16{-1})
+	h.AddVariable("name", []string{"lat", "strlen"}, "")
+	if err := h.Define(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, cleanup := createTestFile(t, h)
+	defer cleanup()
+	if n, _ := mustWriter(t, f, "lat", nil, nil).Write([]float32{10.5, 20}); n != 2 {
+		t.Fatal("writing lat")
+	}
+	if n, _ := mustWriter(t, f, "name", nil, nil).Write([]int8{'a', 'b', 0, 'c', ',', 'd'}); n != 6 {
+		t.Fatal("writing name")
+	}
+	a, _ := f.Appender()
+	for _, r := range []map[string]interface{}{
+		{"time": []float64{0}, "t": []int16{1, -1}},
+		{"time": []float64{6.5}, "t": []int16{3, 4}},
+	} {
+		if _, err := a.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		v      string
+		format TableFormat
+		exp    string
+	}{
+		{"t", CSV, "time,lat,t\n" +
+			"2000-01-01T00:00:00Z,10.5,1\n" +
+			"2000-01-01T00:00:00Z,20,\n" +
+			"2000-01-01T06:30:00Z,10.5,3\n" +
+			"2000-01-01T06:30:00Z,20,4\n"},
+		{"t", JSON, `{"time":"2000-01-01T00:00:00Z","lat":10.5,"t":1}` + "\n" +
+			`{"time":"2000-01-01T00:00:00Z","lat":20,"t":null}` + "\n" +
+			`{"time":"2000-01-01T06:30:00Z","lat":10.5,"t":3}` + "\n" +
+			`{"time":"2000-01-01T06:30:00Z","lat":20,"t":4}` + "\n"},
+		{"name", TSV, "lat\tname\n10.5\tab\n20\tc,d\n"},
+		{"name", CSV, "lat,name\n10.5,ab\n20,\"c,d\"\n"},
+		{"lat", JSON, `{"lat":10.5}` + "\n" + `{"lat":20}` + "\n"},
+	} {
+		var buf bytes.Buffer
+		if err := f.WriteTable(&buf, tc.v, tc.format); err != nil {
+			t.Fatal(tc.v, err)
+		}
+		if buf.String() != tc.exp {
+			t.Errorf("%s/%d: got\n%s\nexpected\n%s", tc.v, tc.format, buf.String(), tc.exp)
+		}
+	}
+
+	if err := f.WriteTable(new(bytes.Buffer), "nope", CSV); err != ErrUnknownVariable {
+		t.Error("expected ErrUnknownVariable, got", err)
+	}
+	if err := f.WriteTable(new(bytes.Buffer), "t", JSON+1); err != errTableFormat {
+		t.Error("expected errTableFormat, got", err)
+	}
+}
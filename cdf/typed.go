@@ -0,0 +1,178 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the statically typed readers and writers of CDF variable data.
+
+package cdf
+
+import (
+	"io"
+	"unsafe"
+)
+
+// Elem is the set of Go types that can hold the elements of a variable.
+// A variable of NetCDF type CHAR or BYTE is accessed as int8, SHORT as int16,
+// INT as int32, FLOAT as float32, DOUBLE as float64, and the CDF-5 types
+// UBYTE, USHORT, UINT, INT64 and UINT64 as uint8, uint16, uint32, int64 and uint64.
+type Elem interface {
+	int8 | int16 | int32 | float32 | float64 | uint8 | uint16 | uint32 | int64 | uint64
+}
+
+// elemMatches reports whether T is the Go type for elements of type dtype.
+func elemMatches[T Elem](dtype datatype) bool {
+	var z T
+	switch any(z).(type) {
+	case int8:
+		return dtype == _BYTE || dtype == _CHAR
+	case int16:
+		return dtype == _SHORT
+	case int32:
+		return dtype == _INT
+	case float32:
+		return dtype == _FLOAT
+	case float64:
+		return dtype == _DOUBLE
+	case uint8:
+		return dtype == _UBYTE
+	case uint16:
+		return dtype == _USHORT
+	case uint32:
+		return dtype == _UINT
+	case int64:
+		return dtype == _INT64
+	case uint64:
+		return dtype == _UINT64
+	}
+	return false
+}
+
+// typedLinearStrider checks v and the corners and returns the strider for NewTypedReader and NewTypedWriter.
+func typedLinearStrider[T Elem](f *File, v string, begin, end []int) (*strider, error) {
+	vv := f.Header.varByName(v)
+	if vv == nil {
+		return nil, ErrUnknownVariable
+	}
+	if !elemMatches[T](vv.dtype) {
+		return nil, badValueType
+	}
+	return f.linearStrider(vv, begin, end)
+}
+
+// readElemsOf is the strider's readElems for elements of Go type T, without converting values to an interface.
+func readElemsOf[T Elem](s *strider, values []T) (int, error) {
+	var z T
+	return s.readBytes(int(unsafe.Sizeof(z)), asBytes(values))
+}
+
+// writeElemsOf is the strider's writeElems for elements of Go type T.
+func writeElemsOf[T Elem](s *strider, values []T) (int, error) {
+	var z T
+	return s.writeBytes(int(unsafe.Sizeof(z)), asBytes(values))
+}
+
+// A TypedReader reads elements of Go type T from a variable.  The type is checked
+// against the variable once, when the reader is created.
+type TypedReader[T Elem] struct {
+	s *strider
+}
+
+// NewTypedReader creates a reader for variable v of f that starts at the corner begin and ends at end,
+// with the same defaults as File.Reader, including the limit to the committed records.  It returns an error if v does not exist, the corners
+// have the wrong rank, or T is not the Go type for the elements of v.
+func NewTypedReader[T Elem](f *File, v string, begin, end []int) (*TypedReader[T], error) {
+	s, err := typedLinearStrider[T](f, v, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	if end == nil {
+		f.limitToRecords(s, f.Header.varByName(v))
+	}
+	return &TypedReader[T]{s: s}, nil
+}
+
+// Read reads len(values) elements from the underlying file into values.  It returns
+// the number of elements actually read.  If n < len(values), err will be set.
+func (r *TypedReader[T]) Read(values []T) (n int, err error) {
+	return readElemsOf(r.s, values)
+}
+
+// Zero returns a slice for Read.  If n < 0, the slice will be of the length
+// that can be read contiguously.
+func (r *TypedReader[T]) Zero(n int) []T {
+	if n < 0 {
+		var z T
+		n = int(r.s.size / int64(unsafe.Sizeof(z)))
+	}
+	return make([]T, n)
+}
+
+// A TypedWriter writes elements of Go type T to a variable.  The type is checked
+// against the variable once, when the writer is created.
+type TypedWriter[T Elem] struct {
+	s *strider
+}
+
+// NewTypedWriter creates a writer for variable v of f that starts at the corner begin and ends at end,
+// with the same defaults as File.Writer.  It returns an error if v does not exist, the corners
+// have the wrong rank, or T is not the Go type for the elements of v.
+func NewTypedWriter[T Elem](f *File, v string, begin, end []int) (*TypedWriter[T], error) {
+	s, err := typedLinearStrider[T](f, v, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedWriter[T]{s: s}, nil
+}
+
+// Write writes len(values) elements from values to the underlying file.  If n < len(values), err will be set.
+func (w *TypedWriter[T]) Write(values []T) (n int, err error) {
+	return writeElemsOf(w.s, values)
+}
+
+// ReadVar reads all elements of variable v between the corners begin and end,
+// with the same defaults as File.Reader.
+func ReadVar[T Elem](f *File, v string, begin, end []int) ([]T, error) {
+	r, err := NewTypedReader[T](f, v, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	var values []T
+	chunk := r.Zero(-1)
+	if len(chunk) == 0 {
+		chunk = r.Zero(1)
+	}
+	for {
+		n, err := r.Read(chunk)
+		values = append(values, chunk[:n]...)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return values, err
+		}
+	}
+}
+
+// WriteVar writes values to variable v starting at the corner begin,
+// with the same defaults as File.Writer.  It returns the number of elements written.
+func WriteVar[T Elem](f *File, v string, begin []int, values []T) (int, error) {
+	w, err := NewTypedWriter[T](f, v, begin, nil)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(values)
+	if n == len(values) {
+		err = nil
+	}
+	return n, err
+}
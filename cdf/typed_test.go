@@ -0,0 +1,93 @@
+// Copyright 2012 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdf
+
+import (
+	"io"
+	"testing"
+)
+
+func TestTypedReader(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+
+	if _, err := NewTypedReader[float32](f, "g", nil, nil); err != badValueType {
+		t.Error("expected badValueType, got", err)
+	}
+	if _, err := NewTypedReader[int32](f, "nosuchvar", nil, nil); err != ErrUnknownVariable {
+		t.Error("expected ErrUnknownVariable, got", err)
+	}
+	if _, err := NewTypedReader[int32](f, "g", []int{1}, nil); err != ErrBadIndex {
+		t.Error("expected ErrBadIndex, got", err)
+	}
+
+	g, err := ReadVar[int32](f, "g", nil, nil)
+	if err != nil || len(g) != 4*5*6 {
+		t.Fatal("reading g:", len(g), err)
+	}
+	for i, v := range g {
+		if exp := int32(i/30*100 + i/6%5*10 + i%6); v != exp {
+			t.Fatalf("g[%d]: got %d, expected %d", i, v, exp)
+		}
+	}
+
+	r, err := NewTypedReader[int16](f, "f", []int{1, 2, 3}, []int{2, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := r.Zero(10)
+	n, err := r.Read(buf)
+	exp := []int16{123, 124, 130, 131, 132, 133, 134, 200, 201}
+	if n != len(exp) || err != io.EOF {
+		t.Error("reading f:", n, err)
+	}
+	for i, v := range exp {
+		if buf[i] != v {
+			t.Errorf("f: got %v, expected %v", buf[:n], exp)
+			break
+		}
+	}
+
+	h, err := ReadVar[float64](f, "h", nil, nil)
+	if err != nil || len(h) != 4 || h[3] != 3 {
+		t.Error("reading h:", h, err)
+	}
+}
+
+func TestTypedWriter(t *testing.T) {
+	f, cleanup := createBoxTestFile(t)
+	defer cleanup()
+
+	if _, err := NewTypedWriter[int64](f, "h", nil, nil); err != badValueType {
+		t.Error("expected badValueType, got", err)
+	}
+
+	if n, err := WriteVar(f, "g", []int{3, 4, 4}, []int32{-1, -2}); n != 2 || err != nil {
+		t.Error("writing g:", n, err)
+	}
+	g, err := ReadVar[int32](f, "g", []int{3, 4, 3}, nil)
+	if err != nil || len(g) != 3 || g[0] != 343 || g[1] != -1 || g[2] != -2 {
+		t.Error("reading back g:", g, err)
+	}
+
+	// append a record
+	if n, err := WriteVar(f, "h", []int{4}, []float64{4}); n != 1 || err != nil {
+		t.Error("writing h:", n, err)
+	}
+	h, err := ReadVar[float64](f, "h", []int{3}, []int{4})
+	if err != nil || len(h) != 2 || h[0] != 3 || h[1] != 4 {
+		t.Error("reading back h:", h, err)
+	}
+}
@@ -23,9 +23,17 @@ import (
 
 var padding [4]byte // zeroes
 
-// write an (int32, []byte) encoded string
-func writeString(w io.Writer, s string) error {
-	if err := binary.Write(w, binary.BigEndian, int32(len(s))); err != nil {
+// write a NON_NEG field: an int32, or an int64 for V5 headers.
+func writeNonNeg(w io.Writer, v version, n int64) error {
+	if v == _V5 {
+		return binary.Write(w, binary.BigEndian, n)
+	}
+	return binary.Write(w, binary.BigEndian, int32(n))
+}
+
+// write an (NON_NEG, []byte) encoded string
+func writeString(w io.Writer, v version, s string) error {
+	if err := writeNonNeg(w, v, int64(len(s))); err != nil {
 		return err
 	}
 	if _, err := w.Write([]byte(s)); err != nil {
@@ -40,16 +48,16 @@ func writeString(w io.Writer, s string) error {
 }
 
 // used by writeHeader
-func (d *dimension) writeTo(w io.Writer) error {
-	if err := writeString(w, d.name); err != nil {
+func (d *dimension) writeTo(w io.Writer, v version) error {
+	if err := writeString(w, v, d.name); err != nil {
 		return err
 	}
-	return binary.Write(w, binary.BigEndian, d.length)
+	return writeNonNeg(w, v, d.length)
 }
 
 // used by writeHeader
-func (a *attribute) writeTo(w io.Writer) error {
-	if err := writeString(w, a.name); err != nil {
+func (a *attribute) writeTo(w io.Writer, v version) error {
+	if err := writeString(w, v, a.name); err != nil {
 		return err
 	}
 
@@ -63,7 +71,7 @@ func (a *attribute) writeTo(w io.Writer) error {
 	}
 
 	if a.dtype == _CHAR {
-		return writeString(w, a.values.(string))
+		return writeString(w, v, a.values.(string))
 	}
 
 	var nelems int
@@ -81,8 +89,20 @@ func (a *attribute) writeTo(w io.Writer) error {
 		nelems = len(a.values.([]float32))
 	case _DOUBLE:
 		nelems = len(a.values.([]float64))
+	case _UBYTE:
+		nelems = len(a.values.([]uint8))
+		p = 4 - nelems&3
+	case _USHORT:
+		nelems = len(a.values.([]uint16))
+		p = 4 - (2*nelems)&3
+	case _UINT:
+		nelems = len(a.values.([]uint32))
+	case _INT64:
+		nelems = len(a.values.([]int64))
+	case _UINT64:
+		nelems = len(a.values.([]uint64))
 	}
-	if err := binary.Write(w, binary.BigEndian, int32(nelems)); err != nil {
+	if err := writeNonNeg(w, v, int64(nelems)); err != nil {
 		return err
 	}
 	if err := binary.Write(w, binary.BigEndian, a.values); err != nil {
@@ -97,16 +117,16 @@ func (a *attribute) writeTo(w io.Writer) error {
 }
 
 // used by writeHeader
-func (v *variable) writeTo(w io.Writer, offs64 bool) error {
-	if err := writeString(w, v.name); err != nil {
+func (v *variable) writeTo(w io.Writer, vers version) error {
+	if err := writeString(w, vers, v.name); err != nil {
 		return err
 	}
 
-	if err := binary.Write(w, binary.BigEndian, int32(len(v.dim))); err != nil {
+	if err := writeNonNeg(w, vers, int64(len(v.dim))); err != nil {
 		return err
 	}
 	for _, d := range v.dim {
-		if err := binary.Write(w, binary.BigEndian, int32(d)); err != nil {
+		if err := writeNonNeg(w, vers, int64(d)); err != nil {
 			return err
 		}
 	}
@@ -117,12 +137,12 @@ func (v *variable) writeTo(w io.Writer, offs64 bool) error {
 	if err := binary.Write(w, binary.BigEndian, tag); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.BigEndian, int32(len(v.att))); err != nil {
+	if err := writeNonNeg(w, vers, int64(len(v.att))); err != nil {
 		return err
 	}
 
 	for i := range v.att {
-		if err := v.att[i].writeTo(w); err != nil {
+		if err := v.att[i].writeTo(w, vers); err != nil {
 			return err
 		}
 	}
@@ -135,11 +155,19 @@ func (v *variable) writeTo(w io.Writer, offs64 bool) error {
 		return err
 	}
 
-	if err := binary.Write(w, binary.BigEndian, v.vsize); err != nil {
+	// the spec is ambiguous, it says s > 1<<32-4...
+	// but the grammar says NON_NEG is a positive INT
+	// and INT is a signed 32 bit big endian, so we'll set it it 0xffff/-1 if
+	// it doesn't fit.  V5 headers have 64 bit vsize fields.
+	vsize := v.vsize
+	if vers != _V5 && vsize > (1<<31-4) {
+		vsize = -1
+	}
+	if err := writeNonNeg(w, vers, vsize); err != nil {
 		return err
 	}
 
-	if !offs64 {
+	if !vers.offs64() {
 		return binary.Write(w, binary.BigEndian, int32(v.begin))
 	}
 
@@ -155,59 +183,52 @@ func (h *Header) WriteHeader(w io.Writer) error {
 		return err
 	}
 
-	var numrecs int32 = _STREAMING // ignored on reading
-	if err := binary.Write(w, binary.BigEndian, numrecs); err != nil {
+	// numrecs is ignored on reading
+	if err := writeNonNeg(w, h.version, int64(_STREAMING)); err != nil {
 		return err
 	}
 
-	if len(h.dim) == 0 {
-		if err := binary.Write(w, binary.BigEndian, [2]int32{0, 0}); err != nil {
-			return err
-		}
-	} else {
-		if err := binary.Write(w, binary.BigEndian, [2]int32{0xA, int32(len(h.dim))}); err != nil {
+	if err := writeListHeader(w, h.version, 0xA, len(h.dim)); err != nil {
+		return err
+	}
+	for i := range h.dim {
+		if err := h.dim[i].writeTo(w, h.version); err != nil {
 			return err
 		}
-		for i := range h.dim {
-			if err := h.dim[i].writeTo(w); err != nil {
-				return err
-			}
-		}
 	}
 
-	if len(h.att) == 0 {
-		if err := binary.Write(w, binary.BigEndian, [2]int32{0, 0}); err != nil {
-			return err
-		}
-	} else {
-		if err := binary.Write(w, binary.BigEndian, [2]int32{0xC, int32(len(h.att))}); err != nil {
+	if err := writeListHeader(w, h.version, 0xC, len(h.att)); err != nil {
+		return err
+	}
+	for i := range h.att {
+		if err := h.att[i].writeTo(w, h.version); err != nil {
 			return err
 		}
-		for i := range h.att {
-			if err := h.att[i].writeTo(w); err != nil {
-				return err
-			}
-		}
 	}
 
-	if len(h.vars) == 0 {
-		if err := binary.Write(w, binary.BigEndian, [2]int32{0, 0}); err != nil {
-			return err
-		}
-	} else {
-		if err := binary.Write(w, binary.BigEndian, [2]int32{0xB, int32(len(h.vars))}); err != nil {
+	if err := writeListHeader(w, h.version, 0xB, len(h.vars)); err != nil {
+		return err
+	}
+	for i := range h.vars {
+		if err := h.vars[i].writeTo(w, h.version); err != nil {
 			return err
 		}
-		for i := range h.vars {
-			if err := h.vars[i].writeTo(w, h.version == _V2); err != nil {
-				return err
-			}
-		}
 	}
 
 	return nil
 }
 
+// write the tag and number of elements of a list, or ABSENT if n == 0.
+func writeListHeader(w io.Writer, v version, tag int32, n int) error {
+	if n == 0 {
+		tag = 0
+	}
+	if err := binary.Write(w, binary.BigEndian, tag); err != nil {
+		return err
+	}
+	return writeNonNeg(w, v, int64(n))
+}
+
 // a nullWriter discards all data but keeps track of the number of bytes written.
 type nullWriter int64
 
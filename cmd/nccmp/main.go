@@ -0,0 +1,128 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+nccmp compares the headers and data of two NetCDF files.
+
+Usage:
+
+	nccmp [-a abs] [-r rel] [-n count] [-s] a.nc b.nc
+
+Values x and y differ if |x-y| is larger than both abs and rel * max(|x|, |y|).
+Missing values, as defined by the fill value, missing_value and valid range
+attributes, are equal to each other.  For every variable with differing data,
+nccmp prints the number of differences, the largest absolute and relative
+differences, the root mean square difference and the first count differing values.
+
+-s suppresses all output.  The exit status is 0 if no differences were found,
+1 if there were differences and 2 in case of trouble.
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+var (
+	aflg = flag.Float64("a", 0, "Absolute tolerance.")
+	rflg = flag.Float64("r", 0, "Relative tolerance.")
+	nflg = flag.Int("n", 10, "Number of differing values to print per variable.")
+	sflg = flag.Bool("s", false, "Silent, only set the exit status.")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nccmp: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-a abs] [-r rel] [-n count] [-s] a.nc b.nc\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	a, anr := open(flag.Arg(0))
+	b, bnr := open(flag.Arg(1))
+
+	n := *nflg
+	if *sflg {
+		n = 0
+	}
+	d, err := cdf.Diff(a, b, anr, bnr, cdf.Tolerance{Abs: *aflg, Rel: *rflg}, n)
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+	if d.Equal() {
+		return
+	}
+	if !*sflg {
+		w := bufio.NewWriter(os.Stdout)
+		printDiff(w, d)
+		w.Flush()
+	}
+	os.Exit(1)
+}
+
+// open opens the named file and returns it with the number of records to compare.
+func open(name string) (*cdf.File, int64) {
+	ff, err := os.Open(name)
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+	f, err := cdf.Open(ff)
+	numrecs := int64(0)
+	switch e := err.(type) {
+	case nil:
+		numrecs = f.NumRecs()
+	case *cdf.NumRecsError:
+		// compare what is there
+		log.Print(name, ": ", err)
+		numrecs = e.Complete
+		if e.NumRecs < e.Complete {
+			numrecs = e.NumRecs
+		}
+	default:
+		log.Print(name, ": ", err)
+		os.Exit(2)
+	}
+	return f, numrecs
+}
+
+func printDiff(w *bufio.Writer, d *cdf.FileDiff) {
+	for _, s := range d.Header {
+		fmt.Fprintln(w, s)
+	}
+	for _, v := range d.Vars {
+		fmt.Fprintf(w, "variable %s: %d of %d values differ, max abs %g, max rel %g, rms %g\n",
+			v.Var, v.Count, v.Compared, v.MaxAbs, v.MaxRel, v.RMS)
+		for _, e := range v.First {
+			idx := make([]string, len(e.Index))
+			for i, x := range e.Index {
+				idx[i] = fmt.Sprint(x)
+			}
+			fmt.Fprintf(w, "\t%s(%s): %g vs %g\n", v.Var, strings.Join(idx, ","), e.A, e.B)
+		}
+	}
+}
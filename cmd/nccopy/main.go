@@ -0,0 +1,494 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+nccopy copies a NetCDF file, optionally converting it to another version of the format,
+selecting a subset of its variables and of the indices of its dimensions, and renaming,
+adding or deleting attributes and renaming variables and dimensions.
+
+Usage:
+
+	nccopy [-k version] [-v var1,...] [-d dim=first:last] [-V old=new] [-D old=new]
+		[-A var:old=new] [-a var:att=value] [-x var:att] in.nc out.nc
+
+-k sets the version of the output: 1 for the classic format, 2 for the 64-bit offset format
+or 5 for the 64-bit data format.  It defaults to the version of the input, and is raised if the
+output does not fit.
+
+-v copies only the listed variables and the coordinate variables of their dimensions.
+Only the dimensions used by the copied variables are kept.
+
+-d copies only the indices first through last of dimension dim.  Either can be left out to
+mean the first or last index.
+
+-V, -D and -A rename variables, dimensions and attributes, -a adds an attribute or replaces its
+value and -x deletes an attribute.  An empty var denotes a global attribute.  A value in
+double quotes is a string, a comma separated list of numbers takes the type of the attribute it replaces,
+or is an int if all numbers are integers, or a double.  All flags except -k and -v can be repeated,
+and all names refer to the input file.
+
+The data is copied in chunks of a fixed size, so the size of the files is not limited
+by the available memory.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+// A list is a flag that can be repeated.
+type list []string
+
+func (l *list) String() string     { return strings.Join(*l, " ") }
+func (l *list) Set(s string) error { *l = append(*l, s); return nil }
+
+var (
+	kflg = flag.Int("k", 0, "Version of the output: 1, 2 or 5.  Defaults to that of the input.")
+	vflg = flag.String("v", "", "Comma separated list of variables to copy.")
+
+	dflg, Vflg, Dflg, Aflg, aflg, xflg list
+)
+
+func init() {
+	flag.Var(&dflg, "d", "Subset dim=first:last of a dimension.")
+	flag.Var(&Vflg, "V", "Rename variable old=new.")
+	flag.Var(&Dflg, "D", "Rename dimension old=new.")
+	flag.Var(&Aflg, "A", "Rename attribute var:old=new.")
+	flag.Var(&aflg, "a", "Add or replace attribute var:att=value.")
+	flag.Var(&xflg, "x", "Delete attribute var:att.")
+}
+
+// chunk is the number of elements copied at a time.
+const chunk = 1 << 16
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nccopy: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-k version] [-v var1,...] [-d dim=first:last] [-V old=new] [-D old=new] [-A var:old=new] [-a var:att=value] [-x var:att] in.nc out.nc\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	ff, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ff.Close()
+
+	f, err := cdf.Open(ff)
+	numrecs := 0
+	switch e := err.(type) {
+	case nil:
+		numrecs = int(f.NumRecs())
+	case *cdf.NumRecsError:
+		// copy what is there
+		log.Print(flag.Arg(0), ": ", err)
+		numrecs = int(e.Complete)
+		if e.NumRecs < e.Complete {
+			numrecs = int(e.NumRecs)
+		}
+	default:
+		log.Fatal(flag.Arg(0), ": ", err)
+	}
+
+	c, err := newCopier(f.Header, numrecs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gg, err := os.Create(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.copy(f, gg); err != nil {
+		gg.Close()
+		os.Remove(flag.Arg(1))
+		log.Fatal(err)
+	}
+	if err := gg.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// A copier holds the header of the output and the subset of the input to copy.
+type copier struct {
+	h      *cdf.Header
+	vars   []string          // the input variables to copy
+	vnames map[string]string // the output names of the input variables
+	dnames map[string]string // the output names of the input dimensions
+	first  map[string]int    // the first index of the subset of the input dimensions
+	length map[string]int    // the length of the subset of the input dimensions, including the record dimension
+}
+
+// newCopier constructs the output header for in, which has numrecs records, as specified by the flags.
+func newCopier(in *cdf.Header, numrecs int) (*copier, error) {
+	c := &copier{vnames: make(map[string]string), dnames: make(map[string]string), first: make(map[string]int), length: make(map[string]int)}
+
+	dims, lengths := in.Dimensions(""), in.Lengths("")
+	for i, d := range dims {
+		c.dnames[d] = d
+		c.length[d] = lengths[i]
+		if lengths[i] == 0 {
+			c.length[d] = numrecs
+		}
+	}
+	for _, s := range dflg {
+		d, r, ok := strings.Cut(s, "=")
+		l, known := c.length[d]
+		if !ok || !known {
+			return nil, fmt.Errorf("invalid dimension subset %q", s)
+		}
+		fs, ls, ok := strings.Cut(r, ":")
+		first, last := 0, l-1
+		var err error
+		if ok && fs != "" {
+			first, err = strconv.Atoi(fs)
+		}
+		if ok && ls != "" && err == nil {
+			last, err = strconv.Atoi(ls)
+		}
+		if !ok || err != nil || first < 0 || last >= l || first > last {
+			return nil, fmt.Errorf("invalid dimension subset %q", s)
+		}
+		c.first[d], c.length[d] = first, last-first+1
+	}
+
+	// the selected variables, their coordinate variables and the dimensions they use, in the order of the input.
+	c.vars = in.Variables()
+	if *vflg != "" {
+		sel := make(map[string]bool)
+		for _, v := range strings.Split(*vflg, ",") {
+			if in.ZeroValue(v, 0) == nil {
+				return nil, fmt.Errorf("no such variable: %s", v)
+			}
+			sel[v] = true
+			for _, d := range in.Dimensions(v) {
+				if in.IsCoordinateVariable(d) {
+					sel[d] = true
+				}
+			}
+		}
+		var vars []string
+		for _, v := range c.vars {
+			if sel[v] {
+				vars = append(vars, v)
+			}
+		}
+		c.vars = vars
+	}
+	used := make(map[string]bool)
+	for _, v := range c.vars {
+		c.vnames[v] = v
+		for _, d := range in.Dimensions(v) {
+			used[d] = true
+		}
+	}
+
+	if err := rename(c.vnames, Vflg, in.Variables()); err != nil {
+		return nil, err
+	}
+	if err := rename(c.dnames, Dflg, dims); err != nil {
+		return nil, err
+	}
+
+	var odims []string
+	var olengths []int
+	for i, d := range dims {
+		if !used[d] {
+			continue
+		}
+		odims = append(odims, c.dnames[d])
+		if lengths[i] == 0 {
+			olengths = append(olengths, 0)
+		} else {
+			olengths = append(olengths, c.length[d])
+		}
+	}
+	h, err := cdf.MakeHeader(odims, olengths)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range c.vars {
+		var vdims []string
+		for _, d := range in.Dimensions(v) {
+			vdims = append(vdims, c.dnames[d])
+		}
+		if err := h.AddVariable(c.vnames[v], vdims, in.ZeroValue(v, 0)); err != nil {
+			return nil, fmt.Errorf("variable %s: %v", v, err)
+		}
+	}
+
+	if err := c.attributes(in, h); err != nil {
+		return nil, err
+	}
+
+	version := *kflg
+	if version == 0 {
+		version = in.Version()
+	}
+	if err := h.DefineVersion(version); err != nil {
+		return nil, err
+	}
+	c.h = h
+	return c, nil
+}
+
+// rename applies the old=new renames in flags to the names that exist in names.
+func rename(names map[string]string, flags list, known []string) error {
+	for _, s := range flags {
+		old, nw, ok := strings.Cut(s, "=")
+		if !ok || nw == "" || index(known, old) < 0 {
+			return fmt.Errorf("invalid rename %q", s)
+		}
+		if _, ok := names[old]; ok {
+			names[old] = nw
+		}
+	}
+	return nil
+}
+
+// attributes copies the global attributes and those of the copied variables of in to h,
+// renamed, added, replaced and deleted as specified by the -A, -a and -x flags.
+func (c *copier) attributes(in, h *cdf.Header) error {
+	type key struct{ v, a string }
+	names := make(map[key]string)
+	for _, s := range Aflg {
+		va, nw, ok1 := strings.Cut(s, "=")
+		v, a, ok2 := strings.Cut(va, ":")
+		if !ok1 || !ok2 || nw == "" || in.GetAttribute(v, a) == nil {
+			return fmt.Errorf("invalid attribute rename %q", s)
+		}
+		names[key{v, a}] = nw
+	}
+	deleted := make(map[key]bool)
+	for _, s := range xflg {
+		v, a, ok := strings.Cut(s, ":")
+		if !ok || in.GetAttribute(v, a) == nil {
+			return fmt.Errorf("invalid attribute deletion %q", s)
+		}
+		deleted[key{v, a}] = true
+	}
+	values := make(map[key]interface{})
+	var added []key
+	for _, s := range aflg {
+		va, val, ok1 := strings.Cut(s, "=")
+		v, a, ok2 := strings.Cut(va, ":")
+		if !ok1 || !ok2 || a == "" || v != "" && in.ZeroValue(v, 0) == nil {
+			return fmt.Errorf("invalid attribute %q", s)
+		}
+		x, err := attrValue(val, in.GetAttribute(v, a))
+		if err != nil {
+			return fmt.Errorf("attribute %q: %v", s, err)
+		}
+		k := key{v, a}
+		if _, ok := values[k]; !ok && in.GetAttribute(v, a) == nil {
+			added = append(added, k)
+		}
+		values[k] = x
+	}
+
+	for _, v := range append([]string{""}, c.vars...) {
+		var keys []key
+		for _, a := range in.Attributes(v) {
+			keys = append(keys, key{v, a})
+		}
+		for _, k := range added {
+			if k.v == v {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			if deleted[k] {
+				continue
+			}
+			val, ok := values[k]
+			if !ok {
+				val = in.GetAttribute(k.v, k.a)
+			}
+			name, ok := names[k]
+			if !ok {
+				name = k.a
+			}
+			ov := ""
+			if v != "" {
+				ov = c.vnames[v]
+			}
+			if err := h.AddAttribute(ov, name, val); err != nil {
+				return fmt.Errorf("attribute %s:%s: %v", v, k.a, err)
+			}
+		}
+	}
+	return nil
+}
+
+// attrValue parses the value of an attribute given with -a.  Numeric values
+// take the type of old, if that is numeric.
+func attrValue(s string, old interface{}) (interface{}, error) {
+	if strings.HasPrefix(s, `"`) {
+		return strconv.Unquote(s)
+	}
+	var vals []float64
+	isInt := true
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		x, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := strconv.ParseInt(f, 10, 32); err != nil {
+			isInt = false
+		}
+		vals = append(vals, x)
+	}
+	switch old.(type) {
+	case []int8:
+		return convert[int8](vals), nil
+	case []int16:
+		return convert[int16](vals), nil
+	case []int32:
+		return convert[int32](vals), nil
+	case []float32:
+		return convert[float32](vals), nil
+	case []float64:
+		return vals, nil
+	case []uint8:
+		return convert[uint8](vals), nil
+	case []uint16:
+		return convert[uint16](vals), nil
+	case []uint32:
+		return convert[uint32](vals), nil
+	case []int64:
+		return convert[int64](vals), nil
+	case []uint64:
+		return convert[uint64](vals), nil
+	}
+	if isInt {
+		return convert[int32](vals), nil
+	}
+	return vals, nil
+}
+
+func convert[T int8 | int16 | int32 | float32 | uint8 | uint16 | uint32 | int64 | uint64](vals []float64) []T {
+	r := make([]T, len(vals))
+	for i, x := range vals {
+		r[i] = T(x)
+	}
+	return r
+}
+
+// copy creates the output file in ff and copies the selected data of f to it.
+func (c *copier) copy(f *cdf.File, ff *os.File) error {
+	g, err := cdf.Create(ff, c.h)
+	if err != nil {
+		return err
+	}
+	for _, v := range c.vars {
+		dims := f.Header.Dimensions(v)
+		start := make([]int, len(dims))
+		count := make([]int, len(dims))
+		total := 1
+		for i, d := range dims {
+			start[i], count[i] = c.first[d], c.length[d]
+			total *= count[i]
+		}
+		if total == 0 {
+			continue
+		}
+		r, err := f.StridedReader(v, start, count, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %v", v, err)
+		}
+		w, err := g.Writer(c.vnames[v], nil, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %v", v, err)
+		}
+		if err := copyData(w, r, total); err != nil {
+			return fmt.Errorf("%s: %v", v, err)
+		}
+	}
+	return cdf.UpdateNumRecs(ff)
+}
+
+// copyData copies n elements from r to w, chunk elements at a time.
+func copyData(w cdf.Writer, r cdf.Reader, n int) error {
+	buf := r.Zero(chunk)
+	for n > 0 {
+		if n < chunk {
+			buf = slice(buf, n)
+		}
+		nr, err := r.Read(buf)
+		if nr > 0 {
+			if nw, err := w.Write(slice(buf, nr)); nw < nr {
+				return err
+			}
+		}
+		n -= nr
+		if n > 0 && err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// slice returns the first n elements of the slice v.
+func slice(v interface{}, n int) interface{} {
+	switch vv := v.(type) {
+	case []int8:
+		return vv[:n]
+	case []int16:
+		return vv[:n]
+	case []int32:
+		return vv[:n]
+	case []float32:
+		return vv[:n]
+	case []float64:
+		return vv[:n]
+	case []uint8:
+		return vv[:n]
+	case []uint16:
+		return vv[:n]
+	case []uint32:
+		return vv[:n]
+	case []int64:
+		return vv[:n]
+	case []uint64:
+		return vv[:n]
+	}
+	panic("invalid slice type")
+}
+
+func index(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,62 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+ncdap serves the NetCDF files in a directory tree over the DAP2 (OPeNDAP) protocol.
+
+Usage:
+
+	ncdap [-http addr] [dir]
+
+The file dir/sub/file.nc is served as the dataset http://addr/sub/file.nc, with the
+.das, .dds, .dods and .asc responses.  Dir defaults to the current directory, addr to :8080.
+See package code.google.com/p/lvd.go/cdf/dap for the supported constraint expressions.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"code.google.com/p/lvd.go/cdf/dap"
+)
+
+var httpflg = flag.String("http", ":8080", "Address to listen on.")
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ncdap: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-http addr] [dir]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		log.Fatal(dir, ": not a directory")
+	}
+
+	log.Print("serving ", dir, " on ", *httpflg)
+	log.Fatal(http.ListenAndServe(*httpflg, dap.Handler(dir)))
+}
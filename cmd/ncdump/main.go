@@ -0,0 +1,486 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+ncdump prints the header and data of a NetCDF file in CDL syntax, like the Unidata tool
+of the same name.
+
+Usage:
+
+	ncdump [-h] [-c] [-v var1,...] [-n name] file.nc
+
+-h prints the header only, -c prints the data of the coordinate variables only,
+-v prints the data of the listed variables only, and -n overrides the name
+in the first line of the output, which defaults to the file name without its extension.
+
+The file may also be an http or https URL, which is read with Range requests.
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+var (
+	hflg = flag.Bool("h", false, "Show header information only, no data.")
+	cflg = flag.Bool("c", false, "Show data for coordinate variables only.")
+	vflg = flag.String("v", "", "Comma separated list of variables to show data for.")
+	nflg = flag.String("n", "", "Name of the dataset, defaults to the file name.")
+)
+
+const lineWidth = 80
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ncdump: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-h] [-c] [-v var1,...] [-n name] file.nc\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var rw cdf.ReaderWriterAt
+	if strings.HasPrefix(flag.Arg(0), "http://") || strings.HasPrefix(flag.Arg(0), "https://") {
+		r, err := cdf.NewHTTPReaderAt(nil, flag.Arg(0), 1<<16, 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rw = r
+	} else {
+		ff, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer ff.Close()
+		rw = ff
+	}
+
+	f, err := cdf.Open(rw)
+	numrecs := 0
+	switch e := err.(type) {
+	case nil:
+		numrecs = int(f.NumRecs())
+	case *cdf.NumRecsError:
+		// dump what is there
+		log.Print(flag.Arg(0), ": ", err)
+		numrecs = int(e.Complete)
+		if e.NumRecs < e.Complete {
+			numrecs = int(e.NumRecs)
+		}
+	default:
+		log.Fatal(flag.Arg(0), ": ", err)
+	}
+
+	name := *nflg
+	if name == "" {
+		name = filepath.Base(flag.Arg(0))
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+
+	printHeader(w, name, f.Header, numrecs)
+
+	var vars []string
+	switch {
+	case *hflg:
+	case *vflg != "":
+		vars = strings.Split(*vflg, ",")
+	case *cflg:
+		for _, v := range f.Header.Variables() {
+			if f.Header.IsCoordinateVariable(v) {
+				vars = append(vars, v)
+			}
+		}
+	default:
+		vars = f.Header.Variables()
+	}
+
+	if len(vars) > 0 {
+		fmt.Fprintf(w, "data:\n")
+	}
+	for _, v := range vars {
+		if f.Header.ZeroValue(v, 0) == nil {
+			w.Flush()
+			log.Fatal("no such variable: ", v)
+		}
+		if err := printData(w, f, v, numrecs); err != nil {
+			w.Flush()
+			log.Fatal(v, ": ", err)
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// typeName returns the CDL name of the type of the variable or attribute value val.
+func typeName(val interface{}) string {
+	switch val.(type) {
+	case []int8:
+		return "byte"
+	case string:
+		return "char"
+	case []int16:
+		return "short"
+	case []int32:
+		return "int"
+	case []float32:
+		return "float"
+	case []float64:
+		return "double"
+	case []uint8:
+		return "ubyte"
+	case []uint16:
+		return "ushort"
+	case []uint32:
+		return "uint"
+	case []int64:
+		return "int64"
+	case []uint64:
+		return "uint64"
+	}
+	return "<invalid>"
+}
+
+func printHeader(w io.Writer, name string, h *cdf.Header, numrecs int) {
+	fmt.Fprintf(w, "netcdf %s {\n", name)
+
+	dims, lengths := h.Dimensions(""), h.Lengths("")
+	if len(dims) > 0 {
+		fmt.Fprintf(w, "dimensions:\n")
+	}
+	for i, d := range dims {
+		if lengths[i] == 0 {
+			fmt.Fprintf(w, "\t%s = UNLIMITED ; // (%d currently)\n", d, numrecs)
+		} else {
+			fmt.Fprintf(w, "\t%s = %d ;\n", d, lengths[i])
+		}
+	}
+
+	vars := h.Variables()
+	if len(vars) > 0 {
+		fmt.Fprintf(w, "variables:\n")
+	}
+	for _, v := range vars {
+		fmt.Fprintf(w, "\t%s %s", typeName(h.ZeroValue(v, 0)), v)
+		if d := h.Dimensions(v); len(d) > 0 {
+			fmt.Fprintf(w, "(%s)", strings.Join(d, ", "))
+		}
+		fmt.Fprintf(w, " ;\n")
+		for _, a := range h.Attributes(v) {
+			fmt.Fprintf(w, "\t\t%s:%s = %s ;\n", v, a, attrString(h.GetAttribute(v, a)))
+		}
+	}
+
+	if atts := h.Attributes(""); len(atts) > 0 {
+		fmt.Fprintf(w, "\n// global attributes:\n")
+		for _, a := range atts {
+			fmt.Fprintf(w, "\t\t:%s = %s ;\n", a, attrString(h.GetAttribute("", a)))
+		}
+	}
+}
+
+// attrString renders an attribute value as a comma separated list of CDL constants,
+// with type suffixes, or as a quoted string broken after embedded newlines.
+func attrString(val interface{}) string {
+	if s, ok := val.(string); ok {
+		lines := strings.SplitAfter(s, "\n")
+		if len(lines) > 1 && lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		for i := range lines {
+			lines[i] = quote(lines[i])
+		}
+		return strings.Join(lines, ",\n\t\t\t")
+	}
+	return strings.Join(formatValues(val, nil, true), ", ")
+}
+
+// quote renders s as a CDL string constant.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		case 0:
+			b.WriteString(`\0`)
+		default:
+			if c < ' ' || c == 0x7f {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// formatFloat renders x like ncdump does with %.7g or %.15g.  Attribute values always get
+// a decimal point, so that they are read back as floating point values.
+func formatFloat(x float64, prec, bitsize int, attr bool) string {
+	switch {
+	case math.IsNaN(x):
+		return "NaN"
+	case math.IsInf(x, 1):
+		return "Infinity"
+	case math.IsInf(x, -1):
+		return "-Infinity"
+	}
+	s := strconv.FormatFloat(x, 'g', prec, bitsize)
+	if attr && !strings.Contains(s, ".") {
+		if i := strings.IndexByte(s, 'e'); i >= 0 {
+			s = s[:i] + "." + s[i:]
+		} else {
+			s += "."
+		}
+	}
+	return s
+}
+
+// formatValues renders the elements of the slice vals.  Elements equal to fill are rendered as "_".
+// If attr is set, the values get the CDL type suffix for attribute constants.
+func formatValues(vals, fill interface{}, attr bool) []string {
+	var r []string
+	sfx := func(s string) string {
+		if !attr {
+			return ""
+		}
+		return s
+	}
+	switch vv := vals.(type) {
+	case []int8:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, strconv.FormatInt(int64(x), 10)+sfx("b"))
+			}
+		}
+	case []int16:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, strconv.FormatInt(int64(x), 10)+sfx("s"))
+			}
+		}
+	case []int32:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, strconv.FormatInt(int64(x), 10))
+			}
+		}
+	case []float32:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, formatFloat(float64(x), 7, 32, attr)+sfx("f"))
+			}
+		}
+	case []float64:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, formatFloat(x, 15, 64, attr))
+			}
+		}
+	case []uint8:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, strconv.FormatUint(uint64(x), 10)+sfx("UB"))
+			}
+		}
+	case []uint16:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, strconv.FormatUint(uint64(x), 10)+sfx("US"))
+			}
+		}
+	case []uint32:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, strconv.FormatUint(uint64(x), 10)+sfx("U"))
+			}
+		}
+	case []int64:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, strconv.FormatInt(x, 10)+sfx("LL"))
+			}
+		}
+	case []uint64:
+		for _, x := range vv {
+			if x == fill {
+				r = append(r, "_")
+			} else {
+				r = append(r, strconv.FormatUint(x, 10)+sfx("ULL"))
+			}
+		}
+	}
+	return r
+}
+
+// A lineWriter writes comma separated values, wrapping lines at lineWidth.
+type lineWriter struct {
+	w   io.Writer
+	col int
+}
+
+func (l *lineWriter) printf(format string, args ...interface{}) {
+	n, _ := fmt.Fprintf(l.w, format, args...)
+	l.col += n
+	if strings.HasSuffix(format, "\n") {
+		l.col = 0
+	}
+}
+
+// item writes s, preceded by a line break and indentation if it would not fit.
+func (l *lineWriter) item(s string, first bool) {
+	if !first {
+		l.printf(",")
+		if l.col+len(s)+1 > lineWidth {
+			l.printf("\n")
+			l.printf("    ")
+		} else {
+			l.printf(" ")
+		}
+	}
+	l.printf("%s", s)
+}
+
+// printData prints the data section entry for variable v.  Numeric data is printed one row of the
+// innermost dimension per line for variables of rank 2 and up, character data one string per row.
+func printData(w io.Writer, f *cdf.File, v string, numrecs int) error {
+	h := f.Header
+	lengths := append([]int(nil), h.Lengths(v)...)
+	if h.IsRecordVariable(v) {
+		lengths[0] = numrecs
+	}
+
+	total, rowlen := 1, 1
+	for _, l := range lengths {
+		total *= l
+	}
+	if len(lengths) > 0 {
+		rowlen = lengths[len(lengths)-1]
+	}
+	if total == 0 {
+		return nil
+	}
+
+	end := make([]int, len(lengths))
+	for i, l := range lengths {
+		end[i] = l - 1
+	}
+	r, err := f.Reader(v, nil, end)
+	if err != nil {
+		return err
+	}
+
+	_, isChar := h.ZeroValue(v, 0).(string)
+	var buf interface{}
+	if isChar {
+		buf = make([]int8, rowlen)
+	} else {
+		buf = h.ZeroValue(v, rowlen)
+	}
+	fill := h.FillValue(v)
+
+	rows := total / rowlen
+	multiline := len(lengths) > 1
+
+	lw := &lineWriter{w: w}
+	lw.printf("\n %s =", v)
+	if multiline {
+		lw.printf("\n")
+		lw.printf("  ")
+	} else {
+		lw.printf(" ")
+	}
+
+	for row := 0; row < rows; row++ {
+		n, err := r.Read(buf)
+		if n < rowlen {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		if isChar {
+			b := make([]byte, rowlen)
+			for i, c := range buf.([]int8) {
+				b[i] = byte(c)
+			}
+			lw.item(quote(strings.TrimRight(string(b), "\x00")), true)
+		} else {
+			for i, s := range formatValues(buf, fill, false) {
+				lw.item(s, i == 0 && (multiline || row == 0))
+			}
+		}
+
+		switch {
+		case row == rows-1:
+			lw.printf(" ;\n")
+		case multiline:
+			lw.printf(",\n")
+			if len(lengths) > 2 && (row+1)%(lengths[len(lengths)-2]) == 0 {
+				lw.printf("\n")
+			}
+			lw.printf("  ")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+ncexport writes a variable of a NetCDF file to standard output as a table.
+
+Usage:
+
+	ncexport [-f csv|tsv|json] -v var file.nc
+
+Every element of the variable is a row, with a column for every dimension holding the
+value of its coordinate variable, or the index if there is none, and a last column for
+the value.  Times are formatted as in RFC 3339, packed values are unpacked and missing
+values are left empty, or null in json.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+var (
+	fflg = flag.String("f", "csv", "Output format: csv, tsv or json.")
+	vflg = flag.String("v", "", "Variable to export.")
+)
+
+var formats = map[string]cdf.TableFormat{"csv": cdf.CSV, "tsv": cdf.TSV, "json": cdf.JSON}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ncexport: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-f csv|tsv|json] -v var file.nc\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	format, ok := formats[*fflg]
+	if flag.NArg() != 1 || *vflg == "" || !ok {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	ff, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ff.Close()
+
+	f, err := cdf.Open(ff)
+	if _, ok := err.(*cdf.NumRecsError); ok {
+		// export what is there
+		log.Print(flag.Arg(0), ": ", err)
+	} else if err != nil {
+		log.Fatal(flag.Arg(0), ": ", err)
+	}
+
+	if err := f.WriteTable(os.Stdout, *vflg, format); err != nil {
+		log.Fatal(*vflg, ": ", err)
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the conversion of CDL constants to attribute and variable values.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+// CDL type suffixes of numeric constants, longest first.
+var suffixes = []struct{ sfx, typ string }{
+	{"ull", "uint64"},
+	{"ll", "int64"},
+	{"ub", "ubyte"},
+	{"us", "ushort"},
+	{"u", "uint"},
+	{"l", "int"},
+	{"s", "short"},
+	{"b", "byte"},
+	{"f", "float"},
+}
+
+// splitSuffix returns the number in s without its type suffix, and the type
+// name the suffix implies, or "" if it has none.
+func splitSuffix(s string) (string, string) {
+	ls := strings.ToLower(s)
+	hex := strings.HasPrefix(ls, "0x") || strings.HasPrefix(ls, "-0x")
+	for _, x := range suffixes {
+		if hex && (x.sfx == "b" || x.sfx == "f") {
+			continue
+		}
+		if strings.HasSuffix(ls, x.sfx) && len(s) > len(x.sfx) {
+			return s[:len(s)-len(x.sfx)], x.typ
+		}
+	}
+	return s, ""
+}
+
+// constType returns the type name of a numeric constant without suffix.
+func constType(s string) string {
+	if _, t := splitSuffix(s); t != "" {
+		return t
+	}
+	ls := strings.ToLower(s)
+	if strings.HasPrefix(ls, "0x") || strings.HasPrefix(ls, "-0x") {
+		return "int"
+	}
+	if strings.ContainsAny(ls, ".e") || strings.Contains(ls, "nan") || strings.Contains(ls, "inf") {
+		return "double"
+	}
+	return "int"
+}
+
+func parseFloat(s string, bits int) (float64, error) {
+	s, _ = splitSuffix(s)
+	s = strings.Replace(s, "Infinity", "Inf", 1)
+	return strconv.ParseFloat(s, bits)
+}
+
+func parseInt(s string, bits int) (int64, error) {
+	s, _ = splitSuffix(s)
+	x, err := strconv.ParseInt(s, 0, bits)
+	if err == nil {
+		return x, nil
+	}
+	f, ferr := strconv.ParseFloat(s, 64)
+	if ferr != nil || f != math.Trunc(f) || f < -math.Ldexp(1, bits-1) || f >= math.Ldexp(1, bits-1) {
+		return 0, err
+	}
+	return int64(f), nil
+}
+
+func parseUint(s string, bits int) (uint64, error) {
+	s, _ = splitSuffix(s)
+	x, err := strconv.ParseUint(s, 0, bits)
+	if err == nil {
+		return x, nil
+	}
+	f, ferr := strconv.ParseFloat(s, 64)
+	if ferr != nil || f != math.Trunc(f) || f < 0 || f >= math.Ldexp(1, bits) {
+		return 0, err
+	}
+	return uint64(f), nil
+}
+
+// convert parses the numeric tokens in vals into a slice of the same type as zero.
+// Tokens '_' are replaced by fill, which must be nil or of the element type of zero.
+func convert(vals []token, zero, fill interface{}) (interface{}, error) {
+	for _, t := range vals {
+		if t.kind == tString {
+			return nil, fmt.Errorf("string %v in numeric data", t)
+		}
+	}
+	isFill := func(t token) bool { return fill != nil && t.kind == tWord && t.text == "_" }
+	switch zero.(type) {
+	case []int8:
+		r := make([]int8, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(int8)
+				continue
+			}
+			x, e := parseInt(t.text, 8)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = int8(x)
+		}
+		return r, nil
+	case []int16:
+		r := make([]int16, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(int16)
+				continue
+			}
+			x, e := parseInt(t.text, 16)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = int16(x)
+		}
+		return r, nil
+	case []int32:
+		r := make([]int32, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(int32)
+				continue
+			}
+			x, e := parseInt(t.text, 32)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = int32(x)
+		}
+		return r, nil
+	case []int64:
+		r := make([]int64, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(int64)
+				continue
+			}
+			x, e := parseInt(t.text, 64)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = x
+		}
+		return r, nil
+	case []uint8:
+		r := make([]uint8, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(uint8)
+				continue
+			}
+			x, e := parseUint(t.text, 8)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = uint8(x)
+		}
+		return r, nil
+	case []uint16:
+		r := make([]uint16, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(uint16)
+				continue
+			}
+			x, e := parseUint(t.text, 16)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = uint16(x)
+		}
+		return r, nil
+	case []uint32:
+		r := make([]uint32, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(uint32)
+				continue
+			}
+			x, e := parseUint(t.text, 32)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = uint32(x)
+		}
+		return r, nil
+	case []uint64:
+		r := make([]uint64, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(uint64)
+				continue
+			}
+			x, e := parseUint(t.text, 64)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = x
+		}
+		return r, nil
+	case []float32:
+		r := make([]float32, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(float32)
+				continue
+			}
+			x, e := parseFloat(t.text, 32)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = float32(x)
+		}
+		return r, nil
+	case []float64:
+		r := make([]float64, len(vals))
+		for i, t := range vals {
+			if isFill(t) {
+				r[i] = fill.(float64)
+				continue
+			}
+			x, e := parseFloat(t.text, 64)
+			if e != nil {
+				return nil, e
+			}
+			r[i] = x
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("invalid type %T", zero)
+}
+
+// attrValue converts the tokens of an attribute declaration to a value for cdf.Header.AddAttribute.
+// Strings are concatenated.  The type of numeric values is that of zero if not nil, otherwise it is
+// determined by the suffix of the first value, or double if any of the values looks like a floating
+// point number, or int.
+func attrValue(vals []token, zero interface{}) (interface{}, error) {
+	if vals[0].kind == tString {
+		var s []string
+		for _, t := range vals {
+			if t.kind != tString {
+				return nil, fmt.Errorf("mixed string and numeric values")
+			}
+			s = append(s, t.text)
+		}
+		return strings.Join(s, ""), nil
+	}
+
+	if zero == nil {
+		typ := constType(vals[0].text)
+		if _, sfx := splitSuffix(vals[0].text); sfx == "" {
+			for _, t := range vals {
+				if constType(t.text) == "double" {
+					typ = "double"
+				}
+			}
+		}
+		zero = typeNames[typ]
+	}
+	return convert(vals, zero, nil)
+}
+
+// convertData converts the values in d to a slice of the type of the variable.
+// Strings for character variables of rank 2 or more are padded with NUL to whole
+// rows of the innermost dimension.
+func convertData(h *cdf.Header, d dataDecl) (interface{}, error) {
+	zero := h.ZeroValue(d.name, 0)
+	if _, ok := zero.(string); !ok {
+		v, err := convert(d.vals, zero, h.FillValue(d.name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", d.name, err)
+		}
+		return v, nil
+	}
+
+	rowlen := 0
+	if l := h.Lengths(d.name); len(l) > 1 {
+		rowlen = l[len(l)-1]
+	}
+	var b []byte
+	for _, t := range d.vals {
+		var s string
+		switch {
+		case t.kind == tString:
+			s = t.text
+		case t.text == "_":
+		default:
+			return nil, fmt.Errorf("%s: numeric value %v in character data", d.name, t)
+		}
+		b = append(b, s...)
+		if rowlen > 0 && (len(s) == 0 || len(s)%rowlen != 0) {
+			b = append(b, make([]byte, rowlen-len(s)%rowlen)...)
+		}
+	}
+	return string(b), nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+ncgen builds a NetCDF file from a CDL description, as produced by ncdump,
+like the Unidata tool of the same name.
+
+Usage:
+
+	ncgen -o out.nc [in.cdl]
+
+The CDL is read from standard input if no input file is given.  Variables that
+get no values in the data: section are filled with their fill value, as are the
+missing values denoted by '_'.  The number of records is determined by the
+longest record variable in the data: section.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+var oflg = flag.String("o", "", "Name of the NetCDF file to create.")
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ncgen: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -o out.nc [in.cdl]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *oflg == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var (
+		src  []byte
+		err  error
+		name = "<stdin>"
+	)
+	if flag.NArg() == 1 {
+		name = flag.Arg(0)
+		src, err = ioutil.ReadFile(name)
+	} else {
+		src, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c, err := parse(name, src)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ff, err := os.Create(*oflg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := c.write(ff); err != nil {
+		ff.Close()
+		os.Remove(*oflg)
+		log.Fatal(err)
+	}
+
+	if err := ff.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// write creates the NetCDF file described by c in ff.
+func (c *cdl) write(ff *os.File) error {
+	h := c.header
+	f, err := cdf.Create(ff, h)
+	if err != nil {
+		return err
+	}
+
+	// convert all data first, to determine the number of records.
+	vals := make([]interface{}, len(c.data))
+	numrecs := 0
+	for i, d := range c.data {
+		if vals[i], err = convertData(h, d); err != nil {
+			return err
+		}
+		if !h.IsRecordVariable(d.name) {
+			continue
+		}
+		recsize := 1
+		for _, l := range h.Lengths(d.name)[1:] {
+			recsize *= l
+		}
+		if n := (length(vals[i]) + recsize - 1) / recsize; n > numrecs {
+			numrecs = n
+		}
+	}
+
+	for _, v := range h.Variables() {
+		if !h.IsRecordVariable(v) {
+			if err := f.Fill(v); err != nil {
+				return err
+			}
+		}
+	}
+	for r := 0; r < numrecs; r++ {
+		if err := f.FillRecord(r); err != nil {
+			return err
+		}
+	}
+
+	for i, d := range c.data {
+		w, err := f.Writer(d.name, nil, nil)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", c.file, d.line, err)
+		}
+		n, err := w.Write(vals[i])
+		if n < length(vals[i]) {
+			if err == nil || err == io.EOF {
+				err = fmt.Errorf("too many values for %s: %d", d.name, length(vals[i]))
+			}
+			return fmt.Errorf("%s:%d: %v", c.file, d.line, err)
+		}
+	}
+
+	return cdf.UpdateNumRecs(ff)
+}
+
+// length returns the number of elements in the slice or string v.
+func length(v interface{}) int {
+	switch vv := v.(type) {
+	case []int8:
+		return len(vv)
+	case []int16:
+		return len(vv)
+	case []int32:
+		return len(vv)
+	case []float32:
+		return len(vv)
+	case []float64:
+		return len(vv)
+	case []uint8:
+		return len(vv)
+	case []uint16:
+		return len(vv)
+	case []uint32:
+		return len(vv)
+	case []int64:
+		return len(vv)
+	case []uint64:
+		return len(vv)
+	case string:
+		return len(vv)
+	}
+	return 0
+}
@@ -0,0 +1,157 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+const testCDL = `netcdf test {
+dimensions:
+	time = UNLIMITED ; // (2 currently)
+	x = 3 ;
+	len = 4 ;
+variables:
+	int time(time) ;
+		time:units = "days since 2000-01-01" ;
+	short t(time, x) ;
+		t:_FillValue = -1s ;
+		t:valid_range = 0s, 100s ;
+	char name(x, len) ;
+	double d(x) ;
+	ubyte u ;
+
+// global attributes:
+		:title = "a \"test\"\n" ;
+data:
+
+ time = 1, 2 ;
+
+ t =
+  1, _, 3,
+  4, 5, _ ;
+
+ name =
+  "ab",
+  "cdef",
+  "" ;
+
+ d = 0.5, _, 1e3 ;
+}
+`
+
+// generate parses src and writes it to a file in dir with ncgen.
+func generate(t *testing.T, dir, src string) ([]byte, error) {
+	c, err := parse("test.cdl", []byte(src))
+	if err != nil {
+		return nil, err
+	}
+	ff, err := os.Create(filepath.Join(dir, "ncgen.nc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	if err := c.write(ff); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(ff.Name())
+}
+
+func TestNcgen(t *testing.T) {
+	dir := t.TempDir()
+	got, err := generate(t, dir, testCDL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same file built with the cdf package.
+	h := cdf.NewHeader([]string{"time", "x", "len"}, []int{0, 3, 4})
+	h.AddVariable("time", []string{"time"}, []int32{})
+	h.AddVariable("t", []string{"time", "x"}, []int16{})
+	h.AddVariable("name", []string{"x", "len"}, "")
+	h.AddVariable("d", []string{"x"}, []float64{})
+	h.AddVariable("u", nil, []uint8{})
+	h.AddAttribute("time", "units", "days since 2000-01-01")
+	h.AddAttribute("t", "_FillValue", []int16{-1})
+	h.AddAttribute("t", "valid_range", []int16{0, 100})
+	h.AddAttribute("", "title", "a \"test\"\n")
+	if err := h.Define(); err != nil {
+		t.Fatal(err)
+	}
+	ff, err := os.Create(filepath.Join(dir, "cdf.nc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	f, err := cdf.Create(ff, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the padding of the short record variable t is filled too.
+	if err := f.Fill("u"); err != nil {
+		t.Fatal(err)
+	}
+	for r := 0; r < 2; r++ {
+		if err := f.FillRecord(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for v, x := range map[string]interface{}{
+		"time": []int32{1, 2},
+		"t":    []int16{1, -1, 3, 4, 5, -1},
+		"name": "ab\x00\x00cdef\x00\x00\x00\x00",
+		"d":    []float64{0.5, h.FillValue("d").(float64), 1e3},
+	} {
+		w, err := f.Writer(v, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(x); err != nil && err != io.EOF {
+			t.Fatal(v, err)
+		}
+	}
+	if err := cdf.UpdateNumRecs(ff); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := os.ReadFile(ff.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, exp) {
+		t.Errorf("ncgen wrote\n%v\nexpected\n%v", got, exp)
+	}
+}
+
+func TestNcgenErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct{ src, err string }{
+		{`netcdf x { dimensions: x = 1 ; variables: int v(x) ; data: v = "s" ; }`, `string "s" in numeric data`},
+		{`netcdf x { dimensions: x = 1 ; variables: char c(x) ; data: c = 1 ; }`, `numeric value '1' in character data`},
+		{`netcdf x { variables: int v ; v:a = 1, "s" ; }`, `string "s" in numeric data`},
+		{`netcdf x { dimensions: x = 1 ; variables: int v(x) ; data: v = 1, 2 ; }`, `too many values for v`},
+		{`netcdf x { variables: int v(y) ; }`, `y`},
+	} {
+		if _, err := generate(t, dir, tc.src); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, expected %q", tc.src, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the CDL scanner and parser.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+type tokenKind int
+
+const (
+	tEOF    tokenKind = iota
+	tWord             // names, keywords and numbers
+	tString           // a double quoted string, unescaped
+	tPunct            // one of = ; , ( ) { } :
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tEOF:
+		return "EOF"
+	case tString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '+' || c == '-' || c == '@' || c >= 0x80
+}
+
+// scan splits src into tokens, skipping white space and // comments.
+func scan(file string, src []byte) ([]token, error) {
+	var toks []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.IndexByte("=;,(){}:", c) >= 0:
+			toks = append(toks, token{tPunct, string(c), line})
+			i++
+		case c == '"':
+			s, n, err := unquote(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", file, line, err)
+			}
+			toks = append(toks, token{tString, s, line})
+			line += strings.Count(string(src[i:i+n]), "\n")
+			i += n
+		case c == '\\' || isWordChar(c):
+			j := i
+			var b []byte
+			for j < len(src) && (src[j] == '\\' || isWordChar(src[j])) {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				b = append(b, src[j])
+				j++
+			}
+			toks = append(toks, token{tWord, string(b), line})
+			i = j
+		default:
+			return nil, fmt.Errorf("%s:%d: unexpected character %q", file, line, c)
+		}
+	}
+	return append(toks, token{tEOF, "", line}), nil
+}
+
+// unquote decodes the string constant at the start of src, returning its value and length in src.
+func unquote(src []byte) (string, int, error) {
+	var b []byte
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch c {
+		case '"':
+			return string(b), i + 1, nil
+		case '\\':
+			i++
+			if i == len(src) {
+				break
+			}
+			switch c = src[i]; c {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case 'r':
+				c = '\r'
+			case 'a':
+				c = '\a'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case 'v':
+				c = '\v'
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				var o int
+				for k := 0; k < 3 && i < len(src) && src[i] >= '0' && src[i] <= '7'; k++ {
+					o = o*8 + int(src[i]-'0')
+					i++
+				}
+				i--
+				c = byte(o)
+			}
+		}
+		b = append(b, c)
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// A dataDecl is the list of values given to a variable in the data: section.
+type dataDecl struct {
+	name string
+	vals []token
+	line int
+}
+
+// A cdl is the result of parsing a CDL file.
+type cdl struct {
+	file   string
+	name   string
+	header *cdf.Header
+	data   []dataDecl
+}
+
+type parser struct {
+	file string
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.file, t.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.next(); t.kind != tPunct && t.kind != tWord || t.text != text {
+		return p.errorf(t, "expected '%s', found %v", text, t)
+	}
+	return nil
+}
+
+func (p *parser) word() (string, error) {
+	t := p.next()
+	if t.kind != tWord {
+		return "", p.errorf(t, "expected name, found %v", t)
+	}
+	return t.text, nil
+}
+
+// isSection returns whether the next tokens are the section keyword kw followed by a colon.
+func (p *parser) isSection(kw string) bool {
+	return p.peek().kind == tWord && p.peek().text == kw && p.toks[p.pos+1].text == ":"
+}
+
+func (p *parser) atPunct(text string) bool { return p.peek().kind == tPunct && p.peek().text == text }
+
+// The type names of CDL and a zero value of the corresponding Go type for cdf.Header.AddVariable.
+var typeNames = map[string]interface{}{
+	"byte":   []int8{},
+	"char":   "",
+	"short":  []int16{},
+	"int":    []int32{},
+	"long":   []int32{},
+	"float":  []float32{},
+	"real":   []float32{},
+	"double": []float64{},
+	"ubyte":  []uint8{},
+	"ushort": []uint16{},
+	"uint":   []uint32{},
+	"int64":  []int64{},
+	"uint64": []uint64{},
+}
+
+// An attribute declaration, collected until all variables have been declared.
+type attrDecl struct {
+	v, a string
+	vals []token
+	line token
+}
+
+// parse parses a complete CDL file and constructs the defined header.
+func parse(file string, src []byte) (*cdl, error) {
+	toks, err := scan(file, src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{file: file, toks: toks}
+	c := &cdl{file: file}
+
+	if err := p.expect("netcdf"); err != nil {
+		return nil, err
+	}
+	if c.name, err = p.word(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var (
+		dims    []string
+		lengths []int
+		vars    []string
+		vdims   [][]string
+		vtypes  []interface{}
+		attrs   []attrDecl
+	)
+
+	if p.isSection("dimensions") {
+		p.pos += 2
+		for p.peek().kind == tWord && !p.isSection("variables") && !p.isSection("data") {
+			for {
+				t := p.peek()
+				d, err := p.word()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				l, err := p.word()
+				if err != nil {
+					return nil, err
+				}
+				n := 0
+				if l != "UNLIMITED" && l != "unlimited" {
+					if n, err = strconv.Atoi(l); err != nil || n <= 0 {
+						return nil, p.errorf(t, "invalid length for dimension %s: %s", d, l)
+					}
+				}
+				for i := range dims {
+					if dims[i] == d {
+						return nil, p.errorf(t, "repeated dimension %s", d)
+					}
+					if n == 0 && lengths[i] == 0 {
+						return nil, p.errorf(t, "multiple unlimited dimensions")
+					}
+				}
+				dims, lengths = append(dims, d), append(lengths, n)
+				if !p.atPunct(",") {
+					break
+				}
+				p.next()
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if p.isSection("variables") {
+		p.pos += 2
+		for !p.isSection("data") && !p.atPunct("}") {
+			t := p.peek()
+			if zero, ok := typeNames[t.text]; ok && t.kind == tWord && p.toks[p.pos+1].text != ":" {
+				p.next()
+				for {
+					vt := p.peek()
+					v, err := p.word()
+					if err != nil {
+						return nil, err
+					}
+					var vd []string
+					if p.atPunct("(") {
+						p.next()
+						for !p.atPunct(")") {
+							d, err := p.word()
+							if err != nil {
+								return nil, err
+							}
+							vd = append(vd, d)
+							if p.atPunct(",") {
+								p.next()
+							}
+						}
+						p.next()
+					}
+					for _, x := range vars {
+						if x == v {
+							return nil, p.errorf(vt, "repeated variable %s", v)
+						}
+					}
+					for i, d := range vd {
+						k := index(dims, d)
+						if k < 0 {
+							return nil, p.errorf(vt, "undefined dimension %s", d)
+						}
+						if lengths[k] == 0 && i != 0 {
+							return nil, p.errorf(vt, "unlimited dimension %s must be first", d)
+						}
+					}
+					vars, vdims, vtypes = append(vars, v), append(vdims, vd), append(vtypes, zero)
+					if !p.atPunct(",") {
+						break
+					}
+					p.next()
+				}
+				if err := p.expect(";"); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			// [var]:name = values ;
+			var v string
+			if t.kind == tWord {
+				v = t.text
+				p.next()
+				if index(vars, v) < 0 {
+					return nil, p.errorf(t, "attribute for undefined variable %s", v)
+				}
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			a, err := p.word()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			vals, err := p.values()
+			if err != nil {
+				return nil, err
+			}
+			for _, x := range attrs {
+				if x.v == v && x.a == a {
+					return nil, p.errorf(t, "repeated attribute %s:%s", v, a)
+				}
+			}
+			attrs = append(attrs, attrDecl{v, a, vals, t})
+		}
+	}
+
+	h, err := cdf.MakeHeader(dims, lengths)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p.file, err)
+	}
+	for i, v := range vars {
+		h.AddVariable(v, vdims[i], vtypes[i])
+	}
+	for _, a := range attrs {
+		var vt interface{}
+		if a.v != "" && a.a == "_FillValue" {
+			vt = h.ZeroValue(a.v, 0)
+		}
+		val, err := attrValue(a.vals, vt)
+		if err != nil {
+			return nil, p.errorf(a.line, "attribute %s:%s: %v", a.v, a.a, err)
+		}
+		if err := h.AddAttribute(a.v, a.a, val); err != nil {
+			return nil, p.errorf(a.line, "attribute %s:%s: %v", a.v, a.a, err)
+		}
+	}
+	if err := h.Define(); err != nil {
+		return nil, fmt.Errorf("%s: %v", p.file, err)
+	}
+	c.header = h
+
+	if p.isSection("data") {
+		p.pos += 2
+		for !p.atPunct("}") {
+			t := p.peek()
+			v, err := p.word()
+			if err != nil {
+				return nil, err
+			}
+			if index(vars, v) < 0 {
+				return nil, p.errorf(t, "data for undefined variable %s", v)
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			vals, err := p.values()
+			if err != nil {
+				return nil, err
+			}
+			c.data = append(c.data, dataDecl{v, vals, t.line})
+		}
+	}
+
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tEOF {
+		return nil, p.errorf(t, "unexpected %v after end of file", t)
+	}
+	return c, nil
+}
+
+// values parses a comma separated list of values up to and including the terminating semicolon.
+func (p *parser) values() ([]token, error) {
+	var vals []token
+	for {
+		t := p.next()
+		if t.kind != tWord && t.kind != tString {
+			return nil, p.errorf(t, "expected value, found %v", t)
+		}
+		vals = append(vals, t)
+		if t = p.next(); t.text == ";" {
+			return vals, nil
+		}
+		if t.text != "," {
+			return nil, p.errorf(t, "expected ',' or ';', found %v", t)
+		}
+	}
+}
+
+func index(list []string, s string) int {
+	for i, x := range list {
+		if x == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,129 @@
+// Copyright 2013 Luuk van Dijk. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+ncstat prints the number of valid and missing values, the minimum, maximum, mean and
+standard deviation of the numeric variables of a NetCDF file.
+
+Usage:
+
+	ncstat [-v var1,...] [-r | -d dim] file.nc
+
+-v prints the statistics of the listed variables only.  -d prints them for every index
+of dimension dim, for the variables that have it, and -r for every record of the record variables.
+Values are unpacked, and missing values, as defined by the fill value, missing_value and
+valid range attributes, are excluded.  Every variable is read once, in chunks of a fixed size.
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"code.google.com/p/lvd.go/cdf"
+)
+
+var (
+	vflg = flag.String("v", "", "Comma separated list of variables.")
+	dflg = flag.String("d", "", "Dimension to compute statistics along.")
+	rflg = flag.Bool("r", false, "Compute statistics per record.")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ncstat: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-v var1,...] [-r | -d dim] file.nc\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *rflg && *dflg != "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	ff, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ff.Close()
+
+	f, err := cdf.Open(ff)
+	if err != nil {
+		log.Fatal(flag.Arg(0), ": ", err)
+	}
+	h := f.Header
+
+	dim := *dflg
+	if *rflg {
+		for i, l := range h.Lengths("") {
+			if l == 0 {
+				dim = h.Dimensions("")[i]
+			}
+		}
+		if dim == "" {
+			log.Fatal(flag.Arg(0), ": no record dimension")
+		}
+	}
+
+	var vars []string
+	if *vflg != "" {
+		vars = strings.Split(*vflg, ",")
+	} else {
+		for _, v := range h.Variables() {
+			if _, isChar := h.ZeroValue(v, 0).(string); !isChar {
+				vars = append(vars, v)
+			}
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	fmt.Fprintf(w, "%-20s %12s %12s %14s %14s %14s %14s\n", "variable", "valid", "missing", "min", "max", "mean", "stddev")
+	for _, v := range vars {
+		if dim == "" {
+			s, err := f.Stats(v)
+			if err != nil {
+				w.Flush()
+				log.Fatal(v, ": ", err)
+			}
+			printStats(w, v, s)
+			continue
+		}
+
+		hasDim := false
+		for _, d := range h.Dimensions(v) {
+			hasDim = hasDim || d == dim
+		}
+		if !hasDim {
+			continue
+		}
+		st, err := f.StatsAlong(v, dim)
+		if err != nil {
+			w.Flush()
+			log.Fatal(v, ": ", err)
+		}
+		for i := range st {
+			printStats(w, fmt.Sprintf("%s[%s=%d]", v, dim, i), &st[i])
+		}
+	}
+}
+
+func printStats(w *bufio.Writer, name string, s *cdf.Stats) {
+	fmt.Fprintf(w, "%-20s %12d %12d %14.6g %14.6g %14.6g %14.6g\n", name, s.Valid, s.Missing, s.Min, s.Max, s.Mean, s.StdDev)
+}